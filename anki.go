@@ -0,0 +1,1019 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protowire"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	APKG_CONTENT_TYPE = "application/apkg"
+	// Anki considers cards with an interval of three weeks mature, which is
+	// what we map to full confidence
+	ANKI_MATURE_INTERVAL = 21
+	ANKI_MAX_UNPACKED    = 512 << 20
+	// Limit of all media of a package together
+	ANKI_MAX_MEDIA    = 256 << 20
+	ANKI_MODEL_ID     = 1700000000000
+	ANKI_DECK_ID      = 1700000000001
+	ANKI_DEFAULT_DECK = "Default"
+	ANKI_DEFAULT_EASE = 2500
+)
+
+// ankiCollections lists the collection files in the order they are preferred.
+// Newer packages contain a zstd compressed collection and an outdated
+// collection.anki2 only for old clients.
+var ankiCollections = []string{"collection.anki21b", "collection.anki21", "collection.anki2"}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	ankiSoundPattern = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+	ankiImagePattern = regexp.MustCompile(`(?i)<img[^>]*\ssrc=["']?([^"'>]+)`)
+	ankiBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>|</li>`)
+	ankiTagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// The exported collection uses the schema of Anki 2.1 (version 11), which
+// every version of Anki can import
+const ankiSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// importMedia is a media file found in an imported package. It is only
+// stored once the import is not a dry run.
+type importMedia struct {
+	content []byte
+	audio   bool
+}
+
+type ankiCard struct {
+	note int64
+	deck int64
+	ord  int
+	ivl  int
+	reps int
+}
+
+// -------------------------------------------------------------------------------
+// Reading packages
+// -------------------------------------------------------------------------------
+
+// unpackEntry reads a file of the package of at most maxSize bytes. Files of
+// newer packages are zstd compressed on their own.
+func unpackEntry(file *zip.File, maxSize int64) ([]byte, error) {
+	if file.UncompressedSize64 > uint64(maxSize) {
+		return nil, errors.New("package content too large")
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	content, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, errors.New("package content too large")
+	}
+	if !bytes.HasPrefix(content, zstdMagic) {
+		return content, nil
+	}
+	decoder, err := zstd.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	content, err = io.ReadAll(io.LimitReader(decoder, maxSize+1))
+	if err == nil && int64(len(content)) > maxSize {
+		return nil, errors.New("package content too large")
+	}
+	return content, err
+}
+
+// openAnkiCollection writes the collection to a temporary file, since SQLite
+// can only open files. The returned function removes the file again.
+func openAnkiCollection(files map[string]*zip.File) (*sql.DB, func(), error) {
+	for _, name := range ankiCollections {
+		file, ok := files[name]
+		if !ok {
+			continue
+		}
+		content, err := unpackEntry(file, ANKI_MAX_UNPACKED)
+		if err != nil {
+			return nil, nil, err
+		}
+		tmp, err := os.CreateTemp("", "anki-*.db")
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = tmp.Write(content)
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, nil, err
+		}
+		db, err := sql.Open("sqlite", tmp.Name())
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, nil, err
+		}
+		return db, func() {
+			db.Close()
+			os.Remove(tmp.Name())
+		}, nil
+	}
+	return nil, nil, errors.New("package does not contain a collection")
+}
+
+// readAnkiMediaMap returns the name of the zip entry for every media file.
+// Older packages store a JSON object, newer ones a protobuf list where the
+// position of an entry is the name of the zip entry.
+func readAnkiMediaMap(content []byte) map[string]string {
+	files := map[string]string{}
+	legacy := map[string]string{}
+	if json.Unmarshal(content, &legacy) == nil {
+		for entry, name := range legacy {
+			files[name] = entry
+		}
+		return files
+	}
+	for idx := 0; len(content) > 0; {
+		num, typ, n := protowire.ConsumeTag(content)
+		if n < 0 {
+			break
+		}
+		content = content[n:]
+		if num != 1 || typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, content); n < 0 {
+				break
+			}
+			content = content[n:]
+			continue
+		}
+		entry, n := protowire.ConsumeBytes(content)
+		if n < 0 {
+			break
+		}
+		content = content[n:]
+		name, zipName := readAnkiMediaEntry(entry, strconv.Itoa(idx))
+		if name != "" {
+			files[name] = zipName
+		}
+		idx += 1
+	}
+	return files
+}
+
+func readAnkiMediaEntry(entry []byte, zipName string) (string, string) {
+	name := ""
+	for len(entry) > 0 {
+		num, typ, n := protowire.ConsumeTag(entry)
+		if n < 0 {
+			break
+		}
+		entry = entry[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(entry)
+			if n < 0 {
+				return name, zipName
+			}
+			name = string(value)
+			entry = entry[n:]
+		case num == 255 && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(entry)
+			if n < 0 {
+				return name, zipName
+			}
+			zipName = strconv.FormatUint(value, 10)
+			entry = entry[n:]
+		default:
+			if n = protowire.ConsumeFieldValue(num, typ, entry); n < 0 {
+				return name, zipName
+			}
+			entry = entry[n:]
+		}
+	}
+	return name, zipName
+}
+
+// readAnkiModels returns the field names of every note type. Collections up
+// to schema 11 store them as JSON in the col table, newer ones in their own
+// table.
+func readAnkiModels(db *sql.DB) (map[int64][]string, error) {
+	models := map[int64][]string{}
+	var raw string
+	if err := db.QueryRow("SELECT models FROM col").Scan(&raw); err != nil {
+		return nil, err
+	}
+	var legacy map[string]struct {
+		Flds []struct {
+			Name string
+			Ord  int
+		}
+	}
+	if json.Unmarshal([]byte(raw), &legacy) == nil && len(legacy) > 0 {
+		for id, model := range legacy {
+			mid, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				continue
+			}
+			fields := make([]string, len(model.Flds))
+			for _, field := range model.Flds {
+				if field.Ord >= 0 && field.Ord < len(fields) {
+					fields[field.Ord] = field.Name
+				}
+			}
+			models[mid] = fields
+		}
+		return models, nil
+	}
+	rows, err := db.Query("SELECT ntid, name FROM fields ORDER BY ntid, ord")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mid int64
+		var name string
+		if err := rows.Scan(&mid, &name); err != nil {
+			return nil, err
+		}
+		models[mid] = append(models[mid], name)
+	}
+	return models, rows.Err()
+}
+
+// readAnkiDecks returns the names of all decks. Nested decks are separated by
+// "::" like in the user interface of Anki.
+func readAnkiDecks(db *sql.DB) (map[int64]string, error) {
+	names := map[int64]string{}
+	var raw string
+	if err := db.QueryRow("SELECT decks FROM col").Scan(&raw); err != nil {
+		return nil, err
+	}
+	var legacy map[string]struct{ Name string }
+	if json.Unmarshal([]byte(raw), &legacy) == nil && len(legacy) > 0 {
+		for id, deck := range legacy {
+			if did, err := strconv.ParseInt(id, 10, 64); err == nil {
+				names[did] = deck.Name
+			}
+		}
+		return names, nil
+	}
+	rows, err := db.Query("SELECT id, name FROM decks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var did int64
+		var name string
+		if err := rows.Scan(&did, &name); err != nil {
+			return nil, err
+		}
+		names[did] = strings.ReplaceAll(name, "\x1f", "::")
+	}
+	return names, rows.Err()
+}
+
+// ankiFieldColumns maps the fields of a note type to the import columns. The
+// fields are matched by name like the header of a CSV file, if that fails
+// the first field is the vocabulary and the second the translation.
+func ankiFieldColumns(fields []string, mapping map[string]string) []string {
+	columns := make([]string, len(fields))
+	found := map[string]bool{}
+	for idx, name := range fields {
+		for field := range importColumns {
+			expected, mapped := mapping[field]
+			if !mapped {
+				expected = field
+			}
+			if strings.EqualFold(strings.TrimSpace(name), expected) {
+				columns[idx] = field
+				found[field] = true
+			}
+		}
+	}
+	if !found["vocabulary"] && len(columns) > 0 && columns[0] == "" {
+		columns[0] = "vocabulary"
+	}
+	if !found["translation"] && len(columns) > 1 && columns[1] == "" {
+		columns[1] = "translation"
+	}
+	return columns
+}
+
+// ankiFieldText converts the HTML of a field into plain text. Multiple lines
+// are only kept for the notes.
+func ankiFieldText(field string, multiline bool) string {
+	text := ankiSoundPattern.ReplaceAllString(field, "")
+	text = ankiBreakPattern.ReplaceAllString(text, "\n")
+	text = ankiTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if multiline {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines, "; ")
+}
+
+// ankiConfidence maps the interval of a card onto our confidence
+func ankiConfidence(interval int) int {
+	if interval <= 0 {
+		return 0
+	}
+	if interval >= ANKI_MATURE_INTERVAL {
+		return MAX_CONFIDENCE
+	}
+	return interval * MAX_CONFIDENCE / ANKI_MATURE_INTERVAL
+}
+
+func readAnkiCards(db *sql.DB) (map[int64]ankiCard, error) {
+	cards := map[int64]ankiCard{}
+	rows, err := db.Query("SELECT id, nid, did, ord, ivl, reps FROM cards")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var card ankiCard
+		if err := rows.Scan(&id, &card.note, &card.deck, &card.ord, &card.ivl, &card.reps); err != nil {
+			return nil, err
+		}
+		cards[id] = card
+	}
+	return cards, rows.Err()
+}
+
+// readAnkiReviews converts the review log into review events per note.
+// Manual rescheduling is logged without a grade and skipped.
+func readAnkiReviews(db *sql.DB, cards map[int64]ankiCard, user string) (map[int64][]ReviewEvent, error) {
+	events := map[int64][]ReviewEvent{}
+	rows, err := db.Query("SELECT id, cid, ease, time FROM revlog ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, cid int64
+		var ease, duration int
+		if err := rows.Scan(&id, &cid, &ease, &duration); err != nil {
+			return nil, err
+		}
+		card, ok := cards[cid]
+		if !ok || !Grade(ease).valid() {
+			continue
+		}
+		direction := DirectionForward
+		if card.ord > 0 {
+			direction = DirectionReverse
+		}
+		events[card.note] = append(events[card.note], ReviewEvent{
+			User:         user,
+			Time:         time.UnixMilli(id).UTC(),
+			Grade:        Grade(ease),
+			ResponseTime: duration,
+			Direction:    direction,
+		})
+	}
+	return events, rows.Err()
+}
+
+// ankiMediaReader loads the media files referenced by the notes. Notes often
+// share media, so the hash of every file read is kept, empty if the file
+// was ignored.
+type ankiMediaReader struct {
+	files  map[string]*zip.File
+	names  map[string]string
+	media  map[string]importMedia
+	loaded map[string]string
+	size   int64
+}
+
+// setter returns the setter of the media file for the word, or nil if the
+// file is ignored. Files of unsupported types are ignored, but the media of
+// all notes together must not exceed ANKI_MAX_MEDIA.
+func (r *ankiMediaReader) setter(name string, audio bool) (func(*Word), error) {
+	hash, ok := r.loaded[r.names[name]]
+	if !ok {
+		content := r.read(name, audio)
+		if content != nil {
+			r.size += int64(len(content))
+			if r.size > ANKI_MAX_MEDIA {
+				return nil, errors.New("media of the package too large")
+			}
+			sum := sha256.Sum256(content)
+			hash = hex.EncodeToString(sum[:])
+			r.media[hash] = importMedia{content, audio}
+		}
+		r.loaded[r.names[name]] = hash
+	}
+	if hash == "" {
+		return nil, nil
+	}
+	if audio {
+		return func(word *Word) { word.Audio = hash }, nil
+	}
+	return func(word *Word) { word.Image = hash }, nil
+}
+
+// read returns the content of a media file, nil if it cannot be imported
+func (r *ankiMediaReader) read(name string, audio bool) []byte {
+	file, ok := r.files[r.names[name]]
+	if !ok {
+		log.Printf("Media %s is missing in the package", name)
+		return nil
+	}
+	allowed, maxSize := allowedImageTypes, int64(MAX_IMAGE_SIZE)
+	if audio {
+		allowed, maxSize = allowedAudioTypes, int64(MAX_AUDIO_SIZE)
+	}
+	content, err := unpackEntry(file, maxSize)
+	if err != nil {
+		log.Printf("Failed to read media %s: %s", name, err)
+		return nil
+	}
+	if !allowed[http.DetectContentType(content)] {
+		log.Printf("Skipping unsupported media %s", name)
+		return nil
+	}
+	return content
+}
+
+// readAnkiPackage converts every note of the package into an import line.
+// Besides the fields the lines carry the deck name, the reviews and the
+// progress of the cards of the note. Packages with more than maxNotes notes
+// are rejected before any media is read.
+func readAnkiPackage(content []byte, mapping map[string]string, user string, maxNotes int) ([]importLine, map[string]importMedia, string) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, nil, "file is not an Anki package"
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	db, cleanup, err := openAnkiCollection(files)
+	if err != nil {
+		log.Printf("Failed to open Anki collection: %s", err)
+		return nil, nil, "failed to open the collection of the package"
+	}
+	defer cleanup()
+
+	var notes int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notes").Scan(&notes); err != nil {
+		log.Printf("Failed to count Anki notes: %s", err)
+		return nil, nil, "failed to read the notes of the package"
+	}
+	if notes > maxNotes {
+		return nil, nil, "at most " + strconv.Itoa(maxNotes) + " notes are allowed"
+	}
+	media := ankiMediaReader{files: files, names: map[string]string{}, media: map[string]importMedia{}, loaded: map[string]string{}}
+	if file, ok := files["media"]; ok {
+		if raw, err := unpackEntry(file, ANKI_MAX_UNPACKED); err == nil {
+			media.names = readAnkiMediaMap(raw)
+		}
+	}
+	models, err := readAnkiModels(db)
+	if err != nil {
+		log.Printf("Failed to read Anki note types: %s", err)
+		return nil, nil, "failed to read the note types of the package"
+	}
+	for field, name := range mapping {
+		found := false
+		for _, fields := range models {
+			for _, existing := range fields {
+				found = found || strings.EqualFold(existing, name)
+			}
+		}
+		if !found {
+			return nil, nil, "field " + name + " for " + field + " does not exist"
+		}
+	}
+	deckNames, err := readAnkiDecks(db)
+	if err != nil {
+		log.Printf("Failed to read Anki decks: %s", err)
+		return nil, nil, "failed to read the decks of the package"
+	}
+	cards, err := readAnkiCards(db)
+	if err != nil {
+		log.Printf("Failed to read Anki cards: %s", err)
+		return nil, nil, "failed to read the cards of the package"
+	}
+	reviews, err := readAnkiReviews(db, cards, user)
+	if err != nil {
+		log.Printf("Failed to read Anki review log: %s", err)
+		return nil, nil, "failed to read the review log of the package"
+	}
+	// The deck of a note is the deck of its first card
+	noteCards := map[int64][]ankiCard{}
+	for _, card := range cards {
+		noteCards[card.note] = append(noteCards[card.note], card)
+	}
+
+	rows, err := db.Query("SELECT id, mid, tags, flds FROM notes ORDER BY id")
+	if err != nil {
+		log.Printf("Failed to read Anki notes: %s", err)
+		return nil, nil, "failed to read the notes of the package"
+	}
+	defer rows.Close()
+	lines := []importLine{}
+	columns := map[int64][]string{}
+	for rows.Next() {
+		var id, mid int64
+		var tags, fields string
+		if err := rows.Scan(&id, &mid, &tags, &fields); err != nil {
+			log.Printf("Failed to read Anki note: %s", err)
+			return nil, nil, "failed to read the notes of the package"
+		}
+		if _, ok := columns[mid]; !ok {
+			columns[mid] = ankiFieldColumns(models[mid], mapping)
+		}
+		line := importLine{line: len(lines) + 1, events: reviews[id]}
+		sound, image := "", ""
+		for idx, value := range strings.Split(fields, "\x1f") {
+			if match := ankiSoundPattern.FindStringSubmatch(value); match != nil && sound == "" {
+				sound = match[1]
+			}
+			if match := ankiImagePattern.FindStringSubmatch(value); match != nil && image == "" {
+				image = html.UnescapeString(match[1])
+			}
+			if idx >= len(columns[mid]) || columns[mid][idx] == "" {
+				continue
+			}
+			text := ankiFieldText(value, columns[mid][idx] == "notes")
+			if text == "" {
+				continue
+			}
+			set := importColumns[columns[mid][idx]]
+			line.setters = append(line.setters, func(word *Word) { set(word, text) })
+		}
+		if tags = strings.Join(strings.Fields(tags), ","); tags != "" {
+			line.setters = append(line.setters, func(word *Word) { importColumns["tags"](word, tags) })
+		}
+		for _, reference := range []struct {
+			name  string
+			audio bool
+		}{{sound, true}, {image, false}} {
+			if reference.name == "" {
+				continue
+			}
+			set, err := media.setter(reference.name, reference.audio)
+			if err != nil {
+				return nil, nil, err.Error()
+			}
+			if set != nil {
+				line.setters = append(line.setters, set)
+			}
+		}
+
+		noteCard := ankiCard{ord: -1}
+		for _, card := range noteCards[id] {
+			if noteCard.ord < 0 || card.ord < noteCard.ord {
+				noteCard.ord, noteCard.deck = card.ord, card.deck
+			}
+			if card.ivl > noteCard.ivl {
+				noteCard.ivl = card.ivl
+			}
+			if card.reps > noteCard.reps {
+				noteCard.reps = card.reps
+			}
+		}
+		if name := deckNames[noteCard.deck]; name != ANKI_DEFAULT_DECK {
+			line.deckName = name
+		}
+		line.confidence = ankiConfidence(noteCard.ivl)
+		line.repeat = noteCard.reps
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Failed to read Anki notes: %s", err)
+		return nil, nil, "failed to read the notes of the package"
+	}
+	return lines, media.media, ""
+}
+
+// resolveImportDecks assigns the lines to the decks of the same name. Missing
+// decks are added, so the imported words pass the validation. They are only
+// kept with the words imported into them, see keepImportDecks.
+func resolveImportDecks(lines []importLine, options ImportOptions) {
+	if options.Deck >= 0 {
+		return
+	}
+	for idx := range lines {
+		name := lines[idx].deckName
+		if name == "" {
+			continue
+		}
+		id := -1
+		for _, deck := range decks {
+			if strings.EqualFold(deck.Name, name) {
+				id = deck.ID
+				break
+			}
+		}
+		if id < 0 {
+			id = nextDeckID()
+			decks = append(decks, Deck{ID: id, Name: name})
+		}
+		lines[idx].setters = append(lines[idx].setters, func(word *Word) { word.Deck = id })
+	}
+}
+
+// keepImportDecks removes the decks added after the first known ones that
+// no word was imported into. The returned value reports whether any are
+// left to be saved.
+func keepImportDecks(known int, words []Word) bool {
+	used := map[int]bool{}
+	for _, word := range words {
+		used[word.Deck] = true
+	}
+	kept := decks[:known]
+	for _, deck := range decks[known:] {
+		if used[deck.ID] {
+			kept = append(kept, deck)
+			log.Printf("Created deck %s for the import", deck.Name)
+		}
+	}
+	decks = kept
+	return len(decks) > known
+}
+
+// applyImportProgress stores the learning progress of the imported words.
+// Reviews already in the history are skipped, so importing the same package
+// twice does not count them twice.
+func applyImportProgress(lines []importLine, report ImportReport, user string) {
+	known := map[string]bool{}
+	for _, event := range reviewHistory {
+		known[event.WordUUID+"@"+strconv.FormatInt(event.Time.UnixMilli(), 10)] = true
+	}
+	events := []ReviewEvent{}
+	reviewed := []int{}
+	for idx, row := range report.Rows {
+		if row.Action != ImportAdd && row.Action != ImportUpdate {
+			continue
+		}
+		pos := indexOfUUID(vocabulary, row.UUID)
+		if pos < 0 {
+			continue
+		}
+		line := lines[idx]
+		if line.confidence > vocabulary[pos].Confidence {
+			vocabulary[pos].Confidence = line.confidence
+		}
+		if line.repeat > vocabulary[pos].Repeat {
+			vocabulary[pos].Repeat = line.repeat
+		}
+		added := false
+		for _, event := range line.events {
+			key := row.UUID + "@" + strconv.FormatInt(event.Time.UnixMilli(), 10)
+			if known[key] {
+				continue
+			}
+			known[key] = true
+			event.WordUUID = row.UUID
+			events = append(events, event)
+			added = true
+		}
+		if added {
+			reviewed = append(reviewed, pos)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+	recordReviews(events...)
+	for _, pos := range reviewed {
+		scheduler := schedulerForWord(user, vocabulary[pos])
+		vocabulary[pos].Schedule = replaySchedule(wordHistory(vocabulary[pos]), scheduler)
+	}
+	log.Printf("Imported %d reviews", len(events))
+}
+
+// -------------------------------------------------------------------------------
+// Writing packages
+// -------------------------------------------------------------------------------
+
+var mediaExtensions = map[string]string{
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/aiff":      ".aiff",
+	"audio/basic":     ".au",
+	"application/ogg": ".ogg",
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+}
+
+func ankiFieldHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+// ankiChecksum is the duplicate check of Anki: the first 8 hex digits of the
+// SHA-1 of the first field
+func ankiChecksum(text string) int64 {
+	sum := sha1.Sum([]byte(text))
+	value, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	return value
+}
+
+func ankiTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	list := make([]string, len(tags))
+	for idx, tag := range tags {
+		list[idx] = strings.Join(strings.Fields(tag), "_")
+	}
+	return " " + strings.Join(list, " ") + " "
+}
+
+func ankiCollectionJSON(deckName string, now time.Time) (string, string, string, string) {
+	mod := now.Unix()
+	fields := []map[string]interface{}{}
+	for idx, name := range []string{"Vocabulary", "Translation", "Notes"} {
+		fields = append(fields, map[string]interface{}{
+			"name": name, "ord": idx, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{},
+		})
+	}
+	models := map[string]interface{}{
+		strconv.FormatInt(ANKI_MODEL_ID, 10): map[string]interface{}{
+			"id": ANKI_MODEL_ID, "name": "Vocabulary", "type": 0, "mod": mod, "usn": -1, "sortf": 0, "did": ANKI_DECK_ID,
+			"tmpls": []map[string]interface{}{{
+				"name": "Card 1", "ord": 0, "did": nil, "bqfmt": "", "bafmt": "",
+				"qfmt": "{{Vocabulary}}",
+				"afmt": "{{FrontSide}}\n\n<hr id=answer>\n\n{{Translation}}<br><br>{{Notes}}",
+			}},
+			"flds":      fields,
+			"css":       ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n",
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"tags":      []string{},
+			"vers":      []string{},
+			"req":       []interface{}{[]interface{}{0, "any", []int{0}}},
+		},
+	}
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "desc": "", "mod": mod, "usn": -1, "dyn": 0, "conf": 1, "collapsed": false,
+			"browserCollapsed": false, "extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	deckList := map[string]interface{}{
+		"1":                                 deck(1, ANKI_DEFAULT_DECK),
+		strconv.FormatInt(ANKI_DECK_ID, 10): deck(ANKI_DECK_ID, deckName),
+	}
+	options := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": ANKI_DEFAULT_DECK, "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0,
+			"replayq": true, "dyn": false,
+			"new":   map[string]interface{}{"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": ANKI_DEFAULT_EASE, "order": 1, "perDay": 20, "bury": false, "separate": true},
+			"rev":   map[string]interface{}{"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "bury": false},
+			"lapse": map[string]interface{}{"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+		},
+	}
+	conf := map[string]interface{}{
+		"nextPos": 1, "estTimes": true, "activeDecks": []int{1}, "sortType": "noteFld", "timeLim": 0,
+		"sortBackwards": false, "addToCur": true, "curDeck": 1, "newSpread": 0, "dueCounts": true,
+		"curModel": strconv.FormatInt(ANKI_MODEL_ID, 10), "collapseTime": 1200,
+	}
+	encode := func(value interface{}) string {
+		raw, _ := json.Marshal(value)
+		return string(raw)
+	}
+	return encode(conf), encode(models), encode(deckList), encode(options)
+}
+
+// writeAnkiCollection fills an empty collection with one note and card per
+// word. The card keeps the schedule of the word and the review log is
+// replayed from the history.
+func writeAnkiCollection(db *sql.DB, words []Word, deckName string, mediaNames map[string]string, now time.Time) error {
+	if _, err := db.Exec(ankiSchema); err != nil {
+		return err
+	}
+	crt := startOfDay(now.UTC())
+	for _, word := range words {
+		if !word.Created.IsZero() && word.Created.Before(crt) {
+			crt = startOfDay(word.Created.UTC())
+		}
+	}
+	conf, models, deckList, options := ankiCollectionJSON(deckName, now)
+	_, err := db.Exec("INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		crt.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, deckList, options)
+	if err != nil {
+		return err
+	}
+
+	base := now.UnixMilli()
+	usedReviews := map[int64]bool{}
+	for idx, word := range words {
+		id := base + int64(idx)
+		front := ankiFieldHTML(word.Vocabulary)
+		if name, ok := mediaNames[word.Audio]; ok {
+			front += "[sound:" + name + "]"
+		}
+		back := ankiFieldHTML(word.Translation)
+		if name, ok := mediaNames[word.Image]; ok {
+			back += "<br><img src=\"" + html.EscapeString(name) + "\">"
+		}
+		fields := strings.Join([]string{front, back, ankiFieldHTML(word.Notes)}, "\x1f")
+		_, err := db.Exec("INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')",
+			id, word.UUID, ANKI_MODEL_ID, now.Unix(), ankiTags(word.Tags), fields, word.Vocabulary, ankiChecksum(word.Vocabulary))
+		if err != nil {
+			return err
+		}
+
+		// Write the review log with the intervals the scheduler computed
+		scheduler := schedulerForWord("", word)
+		state := Schedule{}
+		reviews := 0
+		for _, event := range wordHistory(word) {
+			if !event.Grade.valid() {
+				continue
+			}
+			next := scheduler.Next(state, event.Grade, event.Time)
+			reviewType := 1
+			if reviews == 0 {
+				reviewType = 0
+			}
+			reviewID := event.Time.UnixMilli()
+			for usedReviews[reviewID] {
+				reviewID += 1
+			}
+			usedReviews[reviewID] = true
+			factor := int(next.Ease * 1000)
+			if factor == 0 {
+				factor = ANKI_DEFAULT_EASE
+			}
+			_, err := db.Exec("INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, ?, ?, ?)",
+				reviewID, id, int(event.Grade), next.Interval, state.Interval, factor, event.ResponseTime, reviewType)
+			if err != nil {
+				return err
+			}
+			state = next
+			reviews += 1
+		}
+
+		// New cards are due by position, review cards by days since creation
+		cardType, due, interval, factor := 0, idx+1, 0, 0
+		if !word.Schedule.LastReview.IsZero() {
+			cardType = 2
+			due = int(startOfDay(word.Schedule.Due.UTC()).Sub(crt).Hours() / 24)
+			interval = word.Schedule.Interval
+			if interval < 1 {
+				interval = 1
+			}
+			factor = int(word.Schedule.Ease * 1000)
+			if factor == 0 {
+				factor = ANKI_DEFAULT_EASE
+			}
+		}
+		if reviews < word.Repeat {
+			reviews = word.Repeat
+		}
+		_, err = db.Exec("INSERT INTO cards VALUES (?, ?, ?, 0, ?, -1, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, '')",
+			id, id, ANKI_DECK_ID, now.Unix(), cardType, cardType, due, interval, factor, reviews, word.Schedule.Lapses)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportAnkiPackage writes the words as an .apkg file into a single deck with
+// the given name.
+func exportAnkiPackage(w io.Writer, words []Word, deckName string, now time.Time) error {
+	archive := zip.NewWriter(w)
+
+	// Media files are numbered in the package and mapped to their names
+	mediaNames := map[string]string{}
+	mediaMap := map[string]string{}
+	hashes := []string{}
+	for _, word := range words {
+		for _, hash := range []string{word.Audio, word.Image} {
+			if _, ok := mediaNames[hash]; hash != "" && !ok {
+				mediaNames[hash] = ""
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	for _, hash := range hashes {
+		content, err := os.ReadFile(mediaPath(hash))
+		if err != nil {
+			log.Printf("Skipping missing media %s", hash)
+			delete(mediaNames, hash)
+			continue
+		}
+		name := hash + mediaExtensions[http.DetectContentType(content)]
+		entry := strconv.Itoa(len(mediaMap))
+		file, err := archive.Create(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(content); err != nil {
+			return err
+		}
+		mediaNames[hash] = name
+		mediaMap[entry] = name
+	}
+
+	tmp, err := os.CreateTemp("", "anki-*.db")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	db, err := sql.Open("sqlite", tmp.Name())
+	if err != nil {
+		return err
+	}
+	err = writeAnkiCollection(db, words, deckName, mediaNames, now)
+	db.Close()
+	if err != nil {
+		return err
+	}
+	collection, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	file, err := archive.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(collection); err != nil {
+		return err
+	}
+
+	rawMedia, err := json.Marshal(mediaMap)
+	if err != nil {
+		return err
+	}
+	file, err = archive.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(rawMedia); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// storeImportMedia stores the media of an import and returns the hashes so
+// files not used by any imported word can be removed again.
+func storeImportMedia(media map[string]importMedia) []string {
+	hashes := make([]string, 0, len(media))
+	for hash, file := range media {
+		allowed, maxSize := allowedImageTypes, int64(MAX_IMAGE_SIZE)
+		if file.audio {
+			allowed, maxSize = allowedAudioTypes, int64(MAX_AUDIO_SIZE)
+		}
+		if _, problem := storeMediaContent(file.content, maxSize, allowed); problem != nil {
+			log.Printf("Failed to store imported media %s: %s", hash, problem.Detail)
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func ankiTestWords(t *testing.T) []Word {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	image := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	hash, problem := storeMediaContent(image, MAX_IMAGE_SIZE, allowedImageTypes)
+	if problem != nil {
+		t.FailNow()
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	decks = []Deck{}
+	reviewHistory = []ReviewEvent{
+		{WordUUID: "hund", Time: now, Grade: GradeGood, ResponseTime: 2500, Direction: DirectionForward},
+		{WordUUID: "hund", Time: now.AddDate(0, 0, 1), Grade: GradeEasy, ResponseTime: 1200, Direction: DirectionForward},
+	}
+	words := []Word{
+		{UUID: "hund", Vocabulary: "der Hund", Translation: "dog & hound", Tags: []string{"animal", "a1 level"}, Notes: "first line\nsecond <line>", Image: hash, Created: now},
+		{UUID: "katze", Vocabulary: "die Katze", Translation: "cat", Created: now},
+	}
+	words[0].Schedule = replaySchedule(wordHistory(words[0]), SM2Scheduler{})
+	return words
+}
+
+func TestAnkiRoundTrip(t *testing.T) {
+	words := ankiTestWords(t)
+	buffer := new(bytes.Buffer)
+	if err := exportAnkiPackage(buffer, words, "German", time.Now()); err != nil {
+		log.Printf("Failed to export package: %s", err)
+		t.FailNow()
+	}
+	lines, media, message := readAnkiPackage(buffer.Bytes(), map[string]string{}, "", MAX_BATCH_SIZE)
+	if message != "" || len(lines) != 2 || len(media) != 1 {
+		log.Printf("Failed to read package: %s %d %d", message, len(lines), len(media))
+		t.FailNow()
+	}
+	// The notes are counted before any media is read
+	if lines, media, message := readAnkiPackage(buffer.Bytes(), map[string]string{}, "", 1); message == "" || lines != nil || media != nil {
+		log.Printf("Too many notes accepted: %q %d", message, len(media))
+		t.Fail()
+	}
+	if lines[0].deckName != "German" || len(lines[0].events) != 2 || lines[0].repeat != 2 || lines[0].confidence == 0 {
+		log.Printf("Progress lost: %+v", lines[0])
+		t.FailNow()
+	}
+	if len(lines[1].events) != 0 || lines[1].confidence != 0 {
+		log.Printf("New word has progress: %+v", lines[1])
+		t.FailNow()
+	}
+
+	imported, report := applyImport([]Word{}, lines, ImportOptions{Duplicates: DuplicateSkip, Deck: -1}, time.Now())
+	if report.Added != 2 {
+		log.Printf("Import incomplete: %+v", report)
+		t.FailNow()
+	}
+	first := imported[0]
+	if first.Vocabulary != "der Hund" || first.Translation != "dog & hound" || first.Notes != "first line\nsecond <line>" {
+		log.Printf("Fields changed during round trip: %+v", first)
+		t.Fail()
+	}
+	if len(first.Tags) != 2 || first.Tags[0] != "a1_level" || first.Image != words[0].Image {
+		log.Printf("Tags or media lost: %+v", first)
+		t.Fail()
+	}
+}
+
+func TestAnkiImportProgress(t *testing.T) {
+	words := ankiTestWords(t)
+	buffer := new(bytes.Buffer)
+	if err := exportAnkiPackage(buffer, words, "German", time.Now()); err != nil {
+		t.FailNow()
+	}
+	lines, _, _ := readAnkiPackage(buffer.Bytes(), map[string]string{}, "", MAX_BATCH_SIZE)
+	vocabulary = []Word{}
+	reviewHistory = []ReviewEvent{}
+	for round := 0; round < 2; round++ {
+		updated, report := applyImport(vocabulary, lines, ImportOptions{Duplicates: DuplicateUpdate, Deck: 0}, time.Now())
+		vocabulary = updated
+		applyImportProgress(lines, report, "")
+	}
+	// Importing the same package again must not duplicate the reviews
+	if len(vocabulary) != 2 || len(reviewHistory) != 2 {
+		log.Printf("Unexpected state after import: %d words %d reviews", len(vocabulary), len(reviewHistory))
+		t.FailNow()
+	}
+	if vocabulary[0].Schedule.Repetitions != 2 || vocabulary[0].Repeat != 2 || vocabulary[0].Confidence == 0 {
+		log.Printf("Schedule not restored: %+v", vocabulary[0])
+		t.Fail()
+	}
+}
+
+// TestAnkiCompressedPackage converts an exported package into the layout of
+// newer Anki versions with a compressed collection and protobuf media list.
+func TestAnkiCompressedPackage(t *testing.T) {
+	words := ankiTestWords(t)
+	buffer := new(bytes.Buffer)
+	if err := exportAnkiPackage(buffer, words, "German", time.Now()); err != nil {
+		t.FailNow()
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.FailNow()
+	}
+	encoder, _ := zstd.NewWriter(nil)
+	converted := new(bytes.Buffer)
+	writer := zip.NewWriter(converted)
+	for _, file := range archive.File {
+		r, _ := file.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		name := file.Name
+		switch name {
+		case "collection.anki2":
+			name = "collection.anki21b"
+			content = encoder.EncodeAll(content, nil)
+		case "media":
+			mediaMap := readAnkiMediaMap(content)
+			content = nil
+			for name := range mediaMap {
+				entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+				entry = protowire.AppendString(entry, name)
+				content = protowire.AppendTag(content, 1, protowire.BytesType)
+				content = protowire.AppendBytes(content, entry)
+			}
+		default:
+			content = encoder.EncodeAll(content, nil)
+		}
+		w, _ := writer.Create(name)
+		w.Write(content)
+	}
+	writer.Close()
+
+	lines, media, message := readAnkiPackage(converted.Bytes(), map[string]string{"vocabulary": "Vocabulary"}, "", MAX_BATCH_SIZE)
+	if message != "" || len(lines) != 2 || len(media) != 1 {
+		log.Printf("Failed to read compressed package: %s %d %d", message, len(lines), len(media))
+		t.FailNow()
+	}
+	if _, _, message := readAnkiPackage(converted.Bytes(), map[string]string{"vocabulary": "Front"}, "", MAX_BATCH_SIZE); message == "" {
+		log.Print("Mapping to a missing field accepted")
+		t.Fail()
+	}
+	if _, _, message := readAnkiPackage([]byte("no zip"), map[string]string{}, "", MAX_BATCH_SIZE); message == "" {
+		log.Print("Invalid package accepted")
+		t.Fail()
+	}
+}
+
+func TestAnkiFieldText(t *testing.T) {
+	cases := []struct {
+		field     string
+		multiline bool
+		expected  string
+	}{
+		{"der&nbsp;Hund [sound:hund.mp3]", false, "der Hund"},
+		{"<div>dog</div><div>hound</div>", false, "dog; hound"},
+		{"<b>first</b><br>second<img src=\"a.png\">", true, "first\nsecond"},
+		{"&lt;tag&gt;", false, "<tag>"},
+	}
+	for _, test := range cases {
+		if text := ankiFieldText(test.field, test.multiline); text != test.expected {
+			log.Printf("Field %q: expected %q got %q", test.field, test.expected, text)
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpackEntryLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 1000)
+	encoder, _ := zstd.NewWriter(nil)
+	buffer := new(bytes.Buffer)
+	writer := zip.NewWriter(buffer)
+	w, _ := writer.Create("plain")
+	w.Write(content)
+	w, _ = writer.Create("compressed")
+	w.Write(encoder.EncodeAll(content, nil))
+	writer.Close()
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.FailNow()
+	}
+	for _, file := range archive.File {
+		if unpacked, err := unpackEntry(file, 1000); err != nil || len(unpacked) != 1000 {
+			log.Printf("Failed to unpack %s: %s", file.Name, err)
+			t.Fail()
+		}
+		// Both the entry and the decompressed content are limited
+		if _, err := unpackEntry(file, 999); err == nil {
+			log.Printf("Oversized %s accepted", file.Name)
+			t.Fail()
+		}
+	}
+}
+
+func TestImportDecks(t *testing.T) {
+	decks = []Deck{{ID: 1, Name: "German"}}
+	lastDeckID = 1
+	lines := []importLine{{deckName: "german"}, {deckName: "French"}, {deckName: "Travel"}}
+	resolveImportDecks(lines, ImportOptions{Deck: -1})
+	if len(decks) != 3 {
+		log.Printf("Decks of the import missing: %+v", decks)
+		t.FailNow()
+	}
+	words := []Word{}
+	for _, line := range lines[:2] {
+		word := Word{}
+		for _, set := range line.setters {
+			set(&word)
+		}
+		words = append(words, word)
+	}
+	// Only decks words were imported into are kept
+	if !keepImportDecks(1, words) || len(decks) != 2 || decks[1].Name != "French" || words[0].Deck != 1 || words[1].Deck != decks[1].ID {
+		log.Printf("Unexpected decks: %+v %+v", decks, words)
+		t.Fail()
+	}
+	if keepImportDecks(2, []Word{}) || len(decks) != 2 {
+		log.Printf("Known decks removed: %+v", decks)
+		t.Fail()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const DEFAULT_TYPO_THRESHOLD = 0.2
+
+type AnswerResult string
+
+const (
+	AnswerCorrect       AnswerResult = "correct"
+	AnswerAlmostCorrect AnswerResult = "almost"
+	AnswerIncorrect     AnswerResult = "incorrect"
+)
+
+// AnswerMatching configures how strict typed answers are compared. The zero
+// value ignores case and accents and uses the default typo threshold.
+type AnswerMatching struct {
+	CaseSensitive   bool
+	AccentSensitive bool
+	TypoThreshold   *float64 // allowed edits relative to the answer length, 0 allows none
+}
+
+func (r AnswerResult) grade() Grade {
+	switch r {
+	case AnswerCorrect:
+		return GradeGood
+	case AnswerAlmostCorrect:
+		return GradeHard
+	default:
+		return GradeAgain
+	}
+}
+
+// normalizeAnswer brings an answer into Unicode NFC form and collapses all
+// whitespace so that differences in input methods do not matter.
+func normalizeAnswer(answer string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(answer)), " ")
+}
+
+func removeAccents(answer string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(t, answer)
+	if err != nil {
+		return answer
+	}
+	return result
+}
+
+// acceptedAnswers splits a translation like "el perro; el can" or "car/auto"
+// into the separate answers which are all accepted.
+func acceptedAnswers(translation string) []string {
+	parts := strings.FieldsFunc(translation, func(r rune) bool {
+		return r == ';' || r == '/'
+	})
+	answers := []string{}
+	for _, part := range parts {
+		if normalized := normalizeAnswer(part); normalized != "" {
+			answers = append(answers, normalized)
+		}
+	}
+	return answers
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func matchSingleAnswer(given string, expected string, matching AnswerMatching) AnswerResult {
+	if given == expected {
+		return AnswerCorrect
+	}
+	// Differences the user chose to ignore count as correct, otherwise they
+	// are still close enough to be almost correct
+	relaxedGiven := removeAccents(strings.ToLower(given))
+	relaxedExpected := removeAccents(strings.ToLower(expected))
+	if relaxedGiven == relaxedExpected {
+		caseOnly := strings.ToLower(given) == strings.ToLower(expected)
+		accentOnly := removeAccents(given) == removeAccents(expected)
+		if (caseOnly && !matching.CaseSensitive) ||
+			(accentOnly && !matching.AccentSensitive) ||
+			(!matching.CaseSensitive && !matching.AccentSensitive) {
+			return AnswerCorrect
+		}
+		return AnswerAlmostCorrect
+	}
+	threshold := DEFAULT_TYPO_THRESHOLD
+	if matching.TypoThreshold != nil {
+		threshold = *matching.TypoThreshold
+	}
+	allowed := int(threshold * float64(len([]rune(relaxedExpected))))
+	if levenshtein(relaxedGiven, relaxedExpected) <= allowed {
+		return AnswerAlmostCorrect
+	}
+	return AnswerIncorrect
+}
+
+// checkAnswer grades a typed answer against all accepted answers of a word
+// and returns the best result.
+func checkAnswer(given string, expected string, matching AnswerMatching) AnswerResult {
+	given = normalizeAnswer(given)
+	best := AnswerIncorrect
+	if given == "" {
+		return best
+	}
+	for _, answer := range acceptedAnswers(expected) {
+		switch matchSingleAnswer(given, answer, matching) {
+		case AnswerCorrect:
+			return AnswerCorrect
+		case AnswerAlmostCorrect:
+			best = AnswerAlmostCorrect
+		}
+	}
+	return best
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"testing"
+)
+
+func TestCheckAnswer(t *testing.T) {
+	lenient := AnswerMatching{}
+	strict := AnswerMatching{CaseSensitive: true, AccentSensitive: true}
+	low, none := 0.1, 0.0
+	cases := []struct {
+		given    string
+		expected string
+		matching AnswerMatching
+		result   AnswerResult
+	}{
+		{"el perro", "el perro", lenient, AnswerCorrect},
+		{"  el   perro ", "el perro", lenient, AnswerCorrect},
+		{"El Perro", "el perro", lenient, AnswerCorrect},
+		{"El Perro", "el perro", strict, AnswerAlmostCorrect},
+		{"el raton", "el ratón", lenient, AnswerCorrect},
+		{"el raton", "el ratón", strict, AnswerAlmostCorrect},
+		{"El raton", "el ratón", AnswerMatching{AccentSensitive: true}, AnswerAlmostCorrect},
+		// Decomposed input (o + combining acute) equals the composed form
+		{"el ratón", "el ratón", strict, AnswerCorrect},
+		{"el pero", "el perro", lenient, AnswerAlmostCorrect},
+		{"el pero", "el perro", AnswerMatching{TypoThreshold: &low}, AnswerIncorrect},
+		// A threshold of zero allows no typos at all
+		{"el pero", "el perro", AnswerMatching{TypoThreshold: &none}, AnswerIncorrect},
+		{"El raton", "el ratón", AnswerMatching{TypoThreshold: &none}, AnswerCorrect},
+		{"el gato", "el perro", lenient, AnswerIncorrect},
+		{"auto", "car/auto", lenient, AnswerCorrect},
+		{"el can", "el perro; el can", lenient, AnswerCorrect},
+		{"", "el perro", lenient, AnswerIncorrect},
+	}
+	for _, test := range cases {
+		result := checkAnswer(test.given, test.expected, test.matching)
+		if result != test.result {
+			log.Printf("%q against %q: expected %s got %s", test.given, test.expected, test.result, result)
+			t.Fail()
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	if levenshtein("kitten", "sitting") != 3 || levenshtein("", "abc") != 3 || levenshtein("größe", "grösse") != 2 {
+		t.FailNow()
+	}
+}
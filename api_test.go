@@ -40,7 +40,7 @@ func compareWordLists(listExpected []Word, listGiven []Word) bool {
 		return false
 	}
 	for idx := range listExpected {
-		if listExpected[idx] != listGiven[idx] {
+		if !equalWords(listExpected[idx], listGiven[idx]) {
 			return false
 		}
 	}
@@ -84,7 +84,7 @@ func compareAddedCorrectly(originalList []byte, alteredList []byte, word Word) b
 		return false
 	}
 	for idx := range orgwordlist {
-		if orgwordlist[idx] != wordlist[idx] {
+		if !equalWords(orgwordlist[idx], wordlist[idx]) {
 			return false
 		}
 	}
@@ -116,7 +116,7 @@ func compareRemovedCorrectly(originalList []byte, alteredList []byte, removedInd
 	}
 	for idx := range altList {
 		if idx < removedIndex {
-			if orgList[idx] != altList[idx] {
+			if !equalWords(orgList[idx], altList[idx]) {
 				return false
 			}
 		} else {
@@ -147,11 +147,11 @@ func compareModifiedCorrectly(originalList []byte, alteredList []byte, alteredWo
 	}
 	for idx := range orgList {
 		if idx == alteredWord.ID {
-			if altList[idx] != alteredWord {
+			if !equalWords(altList[idx], alteredWord) {
 				return false
 			}
 		} else {
-			if orgList[idx] != altList[idx] {
+			if !equalWords(orgList[idx], altList[idx]) {
 				return false
 			}
 		}
@@ -286,6 +286,7 @@ func TestRemoveWord(t *testing.T) {
 		log.Printf("Failed to request url: %s", err)
 		t.FailNow()
 	}
+	req.Header.Set("If-Match", wordETag(removeWord))
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Print("Failed to request")
@@ -358,6 +359,7 @@ func TestModifyWord(t *testing.T) {
 		log.Print("Failed to post data to url")
 		t.FailNow()
 	}
+	req.Header.Set("If-Match", wordETag(oldWord))
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Print("Failed to post request")
@@ -379,6 +381,8 @@ func TestModifyWord(t *testing.T) {
 		log.Print("Different state at server and client")
 		t.FailNow()
 	}
+	// Every modification increases the revision of the word
+	modifyWord.Revision = oldWord.Revision + 1
 	equal = compareModifiedCorrectly(currentList, body, modifyWord)
 	if !equal {
 		log.Print("Modification of word incorrect")
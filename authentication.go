@@ -41,7 +41,7 @@ func IPWhiteList(whitelist map[string]bool) gin.HandlerFunc {
 		// log.Printf("Ip Range: %s", ipRange)
 		if !whitelist[ip] && !whitelist[ipRange] {
 			log.Printf("Unauthorized access from %s", ip)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "fuck you in the ass blyad"})
+			respondProblem(c, http.StatusForbidden, ErrForbidden, "access from this address is not allowed")
 			return
 		}
 		c.Next()
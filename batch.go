@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+	// Only accepted by POST /sync
+	BatchReview BatchOp = "review"
+)
+
+// Can be changed on start, the default is MAX_BATCH_SIZE
+var maxBatchSize = MAX_BATCH_SIZE
+
+// BatchOperation changes a single word. Updates and deletes address the word
+// by UUID or by its index before the batch was applied, so the indices do not
+// shift between the operations. Updates are merge patches of the word and,
+// like deletes, require the ETag of the word in IfMatch.
+type BatchOperation struct {
+	Op      BatchOp
+	UUID    string
+	ID      *int
+	IfMatch string
+	Word    json.RawMessage
+}
+
+// BatchResult reports the outcome of the operation at the same position. If
+// one operation fails, all others are reported with 424 Failed Dependency.
+type BatchResult struct {
+	Op     BatchOp
+	Status int
+	Word   *Word
+	Error  *Problem
+}
+
+func indexOfUUID(words []Word, uuid string) int {
+	for idx := range words {
+		if words[idx].UUID == uuid {
+			return idx
+		}
+	}
+	return -1
+}
+
+func batchProblem(status int, code ErrorCode, detail string) BatchResult {
+	return BatchResult{Status: status, Error: newProblem(status, code, detail)}
+}
+
+// batchTarget finds the word an update or delete refers to in the current
+// state of the batch.
+func batchTarget(words []Word, original []Word, operation BatchOperation) (int, *BatchResult) {
+	uuid := operation.UUID
+	if uuid == "" && operation.ID != nil {
+		if *operation.ID < 0 || *operation.ID >= len(original) {
+			result := batchProblem(http.StatusNotFound, ErrWordNotFound, "word not found")
+			return -1, &result
+		}
+		uuid = original[*operation.ID].UUID
+	}
+	if uuid == "" {
+		result := batchProblem(http.StatusBadRequest, ErrInvalidRequest, "neither UUID nor ID given")
+		return -1, &result
+	}
+	idx := indexOfUUID(words, uuid)
+	if idx < 0 {
+		result := batchProblem(http.StatusNotFound, ErrWordNotFound, "word not found")
+		return -1, &result
+	}
+	if operation.IfMatch == "" {
+		result := batchProblem(http.StatusPreconditionRequired, ErrPreconditionRequired, "IfMatch is missing")
+		return -1, &result
+	}
+	if !etagMatches(operation.IfMatch, wordETag(words[idx]), false) {
+		result := batchProblem(http.StatusPreconditionFailed, ErrPreconditionFailed, "word was modified in the meantime")
+		return -1, &result
+	}
+	return idx, nil
+}
+
+func validationResult(errors []FieldError) BatchResult {
+	result := batchProblem(http.StatusUnprocessableEntity, ErrValidationFailed, errors[0].Message)
+	result.Error.Errors = errors
+	return result
+}
+
+// applyBatchOperation applies a single operation to the words of the batch.
+func applyBatchOperation(words []Word, original []Word, operation BatchOperation, allowDuplicates bool, now time.Time) ([]Word, BatchResult) {
+	switch operation.Op {
+	case BatchCreate:
+		if errors := checkSchema(decodeWordDocument(operation.Word), wordSchema, false); len(errors) > 0 {
+			return words, validationResult(errors)
+		}
+		var word Word
+		if err := json.Unmarshal(operation.Word, &word); err != nil {
+			return words, batchProblem(http.StatusBadRequest, ErrMalformedBody, "word is in incorrect format")
+		}
+		normalizeWord(&word)
+		if errors := validateWord(word); len(errors) > 0 {
+			return words, validationResult(errors)
+		}
+		if idx, found := findDuplicate(words, word); found && !allowDuplicates {
+			result := batchProblem(http.StatusConflict, ErrWordExists, "word already exists")
+			existing := words[idx]
+			result.Error.Existing = &existing
+			return words, result
+		}
+		word.UUID = newUUID()
+		word.Revision = 0
+		word.Sequence = 0
+		word.Versions = map[string]FieldVersion{}
+		word.Created = now
+		return append(words, word), BatchResult{Status: http.StatusCreated, Word: &word}
+	case BatchUpdate:
+		idx, failed := batchTarget(words, original, operation)
+		if failed != nil {
+			return words, *failed
+		}
+		if errors := checkSchema(decodeWordDocument(operation.Word), wordSchema, true); len(errors) > 0 {
+			return words, validationResult(errors)
+		}
+		patched, err := mergePatchWord(words[idx], operation.Word)
+		if err != nil {
+			return words, batchProblem(http.StatusBadRequest, ErrMalformedBody, "word is in incorrect format")
+		}
+		restoreLearningState(&patched, words[idx])
+		normalizeWord(&patched)
+		if errors := validateWord(patched); len(errors) > 0 {
+			return words, validationResult(errors)
+		}
+		words[idx] = patched
+		return words, BatchResult{Status: http.StatusOK, Word: &patched}
+	case BatchDelete:
+		idx, failed := batchTarget(words, original, operation)
+		if failed != nil {
+			return words, *failed
+		}
+		removed := words[idx]
+		return append(words[:idx], words[idx+1:]...), BatchResult{Status: http.StatusNoContent, Word: &removed}
+	}
+	return words, batchProblem(http.StatusBadRequest, ErrInvalidRequest, "unknown operation "+string(operation.Op))
+}
+
+func decodeWordDocument(raw json.RawMessage) interface{} {
+	var doc interface{}
+	json.Unmarshal(raw, &doc)
+	return doc
+}
+
+// applyBatch applies all operations to a copy of the words. The copy is only
+// returned if every operation succeeded, otherwise the words stay untouched.
+func applyBatch(words []Word, operations []BatchOperation, allowDuplicates bool, now time.Time) ([]Word, []BatchResult, bool) {
+	working := make([]Word, len(words))
+	for idx := range words {
+		working[idx] = cloneWord(words[idx])
+	}
+	results := make([]BatchResult, len(operations))
+	failed := false
+	for idx, operation := range operations {
+		var result BatchResult
+		working, result = applyBatchOperation(working, words, operation, allowDuplicates, now)
+		result.Op = operation.Op
+		results[idx] = result
+		failed = failed || result.Error != nil
+	}
+	if !failed {
+		return working, results, true
+	}
+	for idx := range results {
+		if results[idx].Error == nil {
+			results[idx] = BatchResult{Op: operations[idx].Op, Status: http.StatusFailedDependency}
+		}
+	}
+	return words, results, false
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func postBatch(c *gin.Context) {
+	var operations []BatchOperation
+	if err := c.ShouldBindJSON(&operations); err != nil {
+		log.Printf("Batch is in incorrect format: %s", err)
+		respondBindError(c, err, "batch is in incorrect format")
+		return
+	}
+	if len(operations) == 0 {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "no operations given")
+		return
+	}
+	if len(operations) > maxBatchSize {
+		respondValidationProblem(c, []FieldError{{"", "at most " + strconv.Itoa(maxBatchSize) + " operations are allowed"}})
+		return
+	}
+
+	updated, results, ok := applyBatch(vocabulary, operations, c.Query("allowDuplicate") == "true", time.Now())
+	if !ok {
+		log.Printf("Rejected batch of %d operations", len(operations))
+		respond(c, http.StatusUnprocessableEntity, results)
+		return
+	}
+
+	vocabulary = updated
+	saveVocabularyV2(&vocabulary)
+
+	for idx := range results {
+		word := results[idx].Word
+		if results[idx].Op == BatchDelete {
+			searchIndex.remove(word.UUID)
+			cleanupMedia(word.Audio, word.Image)
+			results[idx].Word = nil
+			continue
+		}
+		// Report the stored state, including the final index and revision
+		if pos := indexOfUUID(vocabulary, word.UUID); pos >= 0 {
+			stored := vocabulary[pos]
+			results[idx].Word = &stored
+			searchIndex.add(stored)
+		}
+	}
+	log.Printf("Applied batch of %d operations", len(operations))
+	respond(c, http.StatusOK, results)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestApplyBatch(t *testing.T) {
+	decks = []Deck{}
+	words := []Word{
+		{ID: 0, UUID: "a", Revision: 1, Vocabulary: "der Hund", Translation: "dog", Confidence: 40},
+		{ID: 1, UUID: "b", Revision: 1, Vocabulary: "die Katze", Translation: "cat"},
+	}
+	zero, one := 0, 1
+	operations := []BatchOperation{
+		{Op: BatchCreate, Word: json.RawMessage(`{"Vocabulary": "das Pferd", "Translation": "horse"}`)},
+		{Op: BatchUpdate, ID: &zero, IfMatch: wordETag(words[0]), Word: json.RawMessage(`{"Translation": "hound", "Confidence": 100}`)},
+		{Op: BatchDelete, ID: &one, IfMatch: wordETag(words[1])},
+	}
+	updated, results, ok := applyBatch(words, operations, false, time.Now())
+	if !ok || len(updated) != 2 {
+		log.Printf("Batch failed: %+v", results)
+		t.FailNow()
+	}
+	if results[0].Status != http.StatusCreated || results[1].Status != http.StatusOK || results[2].Status != http.StatusNoContent {
+		log.Printf("Unexpected results: %+v", results)
+		t.FailNow()
+	}
+	if updated[0].Translation != "hound" || updated[0].Confidence != 40 || updated[1].Vocabulary != "das Pferd" || updated[1].UUID == "" {
+		log.Printf("Batch applied incorrectly: %+v", updated)
+		t.FailNow()
+	}
+	if words[0].Translation != "dog" || len(words) != 2 || words[1].UUID != "b" {
+		log.Printf("Original words modified: %+v", words)
+		t.FailNow()
+	}
+}
+
+func TestApplyBatchAllOrNothing(t *testing.T) {
+	decks = []Deck{}
+	words := []Word{{ID: 0, UUID: "a", Revision: 1, Vocabulary: "der Hund", Translation: "dog"}}
+	operations := []BatchOperation{
+		{Op: BatchCreate, Word: json.RawMessage(`{"Vocabulary": "das Pferd", "Translation": "horse"}`)},
+		{Op: BatchCreate, Word: json.RawMessage(`{"Vocabulary": "der  Hund", "Translation": "dog"}`)},
+		{Op: BatchUpdate, UUID: "a", IfMatch: `"a:7"`, Word: json.RawMessage(`{"Notes": "x"}`)},
+		{Op: BatchDelete, UUID: "a"},
+		{Op: BatchCreate, Word: json.RawMessage(`{"Vocabulary": ""}`)},
+		{Op: "rename"},
+	}
+	updated, results, ok := applyBatch(words, operations, false, time.Now())
+	if ok || len(updated) != 1 || updated[0].Notes != "" {
+		log.Printf("Failed batch was applied: %+v", updated)
+		t.FailNow()
+	}
+	expected := []int{
+		http.StatusFailedDependency,
+		http.StatusConflict,
+		http.StatusPreconditionFailed,
+		http.StatusPreconditionRequired,
+		http.StatusUnprocessableEntity,
+		http.StatusBadRequest,
+	}
+	for idx, status := range expected {
+		if results[idx].Status != status {
+			log.Printf("Operation %d: expected %d got %+v", idx, status, results[idx])
+			t.Fail()
+		}
+	}
+
+	// Duplicates can be allowed explicitly
+	if _, results, ok := applyBatch(words, operations[1:2], true, time.Now()); !ok {
+		log.Printf("Allowed duplicate rejected: %+v", results)
+		t.Fail()
+	}
+}
@@ -4,11 +4,20 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 )
 
+// The client reads the token for the requests from this variable
+const TOKEN_ENV = "VOCABULARY_TOKEN"
+
 // ---------------------------------------------------------
 // CLIENT
 // ---------------------------------------------------------
@@ -69,10 +78,17 @@ func putVocabulary(cfg Configuration, client *http.Client) {
 func removeVocabulary(cfg Configuration, client *http.Client) {
 	addr := cfg.IP_Address + ":" + cfg.Listen_Port
 	url := "https://" + addr + "/words/1"
+	// Deleting requires the current revision of the word
+	current, err := client.Get(url)
+	if err != nil {
+		log.Fatal("Failed to request")
+	}
+	current.Body.Close()
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		log.Fatalf("Failed to request url: %s", err)
 	}
+	req.Header.Set("If-Match", current.Header.Get("ETag"))
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Fatal("Failed to request")
@@ -86,6 +102,120 @@ func removeVocabulary(cfg Configuration, client *http.Client) {
 	log.Printf("Response: %s", string(body))
 }
 
+// exportVocabulary downloads the vocabulary as CSV or TSV into a file
+func exportVocabulary(cfg Configuration, client *http.Client) error {
+	addr := cfg.IP_Address + ":" + cfg.Listen_Port
+	query := url.Values{"format": {cfg.Format}}
+	if cfg.Deck >= 0 {
+		query.Set("deck", strconv.Itoa(cfg.Deck))
+	}
+	req, err := http.NewRequest("GET", "https://"+addr+"/words/export?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("export failed with %d: %s", resp.StatusCode, body)
+	}
+	file, err := os.Create(cfg.Export_File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, resp.Body)
+	log.Printf("Exported vocabulary to %s", cfg.Export_File)
+	return err
+}
+
+// importVocabulary uploads the file in the given format and prints the
+// import report
+func importVocabulary(cfg Configuration, client *http.Client) error {
+	content, err := os.ReadFile(cfg.Import_File)
+	if err != nil {
+		return err
+	}
+	addr := cfg.IP_Address + ":" + cfg.Listen_Port
+	query := url.Values{
+		"format":     {cfg.Format},
+		"duplicates": {cfg.Duplicates},
+		"dryRun":     {strconv.FormatBool(cfg.Dry_Run)},
+	}
+	if cfg.Deck >= 0 {
+		query.Set("deck", strconv.Itoa(cfg.Deck))
+	}
+	for _, column := range strings.Split(cfg.Columns, ",") {
+		if strings.TrimSpace(column) != "" {
+			query.Add("column", strings.TrimSpace(column))
+		}
+	}
+	req, err := http.NewRequest("POST", "https://"+addr+"/words/import?"+query.Encode(), bytes.NewBuffer(content))
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("import failed with %d: %s", resp.StatusCode, body)
+	}
+	log.Printf("Import report: %s", string(body))
+	return nil
+}
+
+// printFlashcards downloads the flashcards of the deck as PDF
+func printFlashcards(cfg Configuration, client *http.Client) error {
+	if cfg.Deck < 0 {
+		return errors.New("printing needs the deck given with -deck")
+	}
+	addr := cfg.IP_Address + ":" + cfg.Listen_Port
+	query := url.Values{
+		"cards": {strconv.Itoa(cfg.Cards_Per_Page)},
+		"paper": {cfg.Paper},
+	}
+	req, err := http.NewRequest("GET", "https://"+addr+"/decks/"+strconv.Itoa(cfg.Deck)+"/print.pdf?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("printing failed with %d: %s", resp.StatusCode, body)
+	}
+	file, err := os.Create(cfg.Print_File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, resp.Body)
+	log.Printf("Printed flashcards to %s", cfg.Print_File)
+	return err
+}
+
+// authorize adds the token from the environment to the request
+func authorize(req *http.Request) {
+	if token := os.Getenv(TOKEN_ENV); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+}
+
 func startingClient(cfg Configuration) error {
 	if cfg.Overwrite {
 		swapExistingVocabulary()
@@ -95,6 +225,26 @@ func startingClient(cfg Configuration) error {
 	}
 	client := &http.Client{Transport: tr}
 
+	if cfg.Print_File != "" {
+		err := printFlashcards(cfg, client)
+		if err != nil {
+			log.Printf("Failed to print the flashcards: %s", err)
+		}
+		return err
+	}
+	if cfg.Export_File != "" || cfg.Import_File != "" {
+		var err error
+		if cfg.Export_File != "" {
+			err = exportVocabulary(cfg, client)
+		} else {
+			err = importVocabulary(cfg, client)
+		}
+		if err != nil {
+			log.Printf("Failed to transfer the vocabulary: %s", err)
+		}
+		return err
+	}
+
 	getVocabulary(cfg, client)
 	putVocabulary(cfg, client)
 	getVocabulary(cfg, client)
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Smaller responses fit into a single packet anyway
+	MIN_COMPRESS_SIZE = 1024
+	BROTLI_LEVEL      = 4
+)
+
+// Can be changed on start, negative values disable the compression
+var minCompressSize = MIN_COMPRESS_SIZE
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressors lists the supported encodings in the order they are preferred
+// if the client accepts several with the same quality. The encoders are
+// pooled, since creating them is more expensive than compressing a response.
+var compressors = []struct {
+	encoding string
+	pool     *sync.Pool
+}{
+	{"zstd", &sync.Pool{New: func() interface{} {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return encoder
+	}}},
+	{"br", &sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(nil, BROTLI_LEVEL)
+	}}},
+	{"gzip", &sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}},
+}
+
+// incompressibleTypes are already compressed, compressing them again only
+// costs time
+var incompressibleTypes = []string{"image/", "audio/", "video/", "application/zip", APKG_CONTENT_TYPE, PDF_CONTENT_TYPE}
+
+// negotiateEncoding picks the encoding with the highest quality in the
+// Accept-Encoding header. A negative result means the response is sent as
+// is.
+func negotiateEncoding(header string) int {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		qualities[strings.ToLower(strings.TrimSpace(coding))] = quality
+	}
+	candidates := []int{}
+	for idx, candidate := range compressors {
+		quality, ok := qualities[candidate.encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > 0 {
+			candidates = append(candidates, idx)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return qualities[compressors[candidates[i]].encoding] > qualities[compressors[candidates[j]].encoding]
+	})
+	return candidates[0]
+}
+
+func compressible(header http.Header, status int) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// compressWriter holds back the start of the response until it is known to
+// be larger than the minimum size. Flushing, as done when streaming, starts
+// the compression right away.
+type compressWriter struct {
+	gin.ResponseWriter
+	compressor int
+	buffer     bytes.Buffer
+	encoder    compressor
+	decided    bool
+}
+
+// decide sends the headers and either starts the encoder or writes the held
+// back content as is.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	if compress && compressible(header, w.Status()) {
+		header.Set("Content-Encoding", compressors[w.compressor].encoding)
+		header.Del("Content-Length")
+		w.encoder = compressors[w.compressor].pool.Get().(compressor)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buffer.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+	w.buffer.Reset()
+	return err
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buffer.Write(data)
+		if w.buffer.Len() < minCompressSize {
+			return len(data), nil
+		}
+		return len(data), w.decide(true)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			log.Printf("Failed to write response: %s", err)
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			log.Printf("Failed to flush compressed response: %s", err)
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes what is left. Responses below the minimum size are sent
+// uncompressed.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			log.Printf("Failed to write response: %s", err)
+		}
+		return
+	}
+	if w.encoder == nil {
+		return
+	}
+	if err := w.encoder.Close(); err != nil {
+		log.Printf("Failed to finish compressed response: %s", err)
+	}
+	w.encoder.Reset(nil)
+	compressors[w.compressor].pool.Put(w.encoder)
+	w.encoder = nil
+}
+
+// -------------------------------------------------------------------------------
+// Middleware
+// -------------------------------------------------------------------------------
+
+// compressResponse compresses responses with the encoding the client prefers
+func compressResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		idx := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if minCompressSize < 0 || idx < 0 || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		writer := &compressWriter{ResponseWriter: c.Writer, compressor: idx}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// Drop partial responses of panicking handlers, the recovery
+			// writes the problem instead
+			if !completed {
+				writer.buffer.Reset()
+			}
+			writer.finish()
+			c.Writer = writer.ResponseWriter
+		}()
+		c.Next()
+		completed = true
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		header   string
+		encoding string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, br, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"*;q=0.2, br;q=0", "zstd"},
+		{"gzip;q=0", ""},
+	}
+	for _, test := range cases {
+		encoding := ""
+		if idx := negotiateEncoding(test.header); idx >= 0 {
+			encoding = compressors[idx].encoding
+		}
+		if encoding != test.encoding {
+			log.Printf("Accept-Encoding %q: expected %q got %q", test.header, test.encoding, encoding)
+			t.Fail()
+		}
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) []byte {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		r, err = zstd.NewReader(bytes.NewReader(body))
+	default:
+		return body
+	}
+	if err != nil {
+		t.FailNow()
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		log.Printf("Failed to decompress %s: %s", encoding, err)
+		t.FailNow()
+	}
+	return content
+}
+
+func TestCompressResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat("der Hund, die Katze, ", 200)
+	router := gin.New()
+	router.Use(compressResponse())
+	router.GET("/small", func(c *gin.Context) {
+		c.String(http.StatusOK, "small")
+	})
+	router.GET("/large", func(c *gin.Context) {
+		c.String(http.StatusOK, large)
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(large))
+	})
+	router.GET("/words", func(c *gin.Context) {
+		respondList(c, http.StatusOK, 500, func(idx int) interface{} {
+			return Word{ID: idx, Vocabulary: "der Hund", Translation: "dog"}
+		})
+	})
+
+	cases := []struct {
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"/small", "gzip", ""},
+		{"/large", "", ""},
+		{"/large", "gzip", "gzip"},
+		{"/large", "br", "br"},
+		{"/large", "zstd", "zstd"},
+		{"/image", "gzip, br", ""},
+		{"/words", "gzip", "gzip"},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		router.ServeHTTP(w, req)
+		if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+			log.Printf("%s with %q: expected encoding %q got %q", test.path, test.accept, test.encoding, encoding)
+			t.Fail()
+			continue
+		}
+		if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+			log.Printf("%s: Vary header missing", test.path)
+			t.Fail()
+		}
+		body := decompress(t, test.encoding, w.Body.Bytes())
+		switch test.path {
+		case "/small":
+			if string(body) != "small" {
+				t.Fail()
+			}
+		case "/words":
+			if !strings.HasPrefix(string(body), "[{\"ID\":0,") || !strings.HasSuffix(string(body), "}]") || strings.Count(string(body), "der Hund") != 500 {
+				log.Printf("Streamed list is incomplete: %d bytes", len(body))
+				t.Fail()
+			}
+		default:
+			if string(body) != large {
+				log.Printf("%s with %q: content changed", test.path, test.accept)
+				t.Fail()
+			}
+		}
+	}
+}
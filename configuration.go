@@ -6,4 +6,23 @@ type Configuration struct {
 	Overwrite   bool
 	Client      bool
 	Token       bool
+	// Keeps the legacy routes and responses for older clients
+	Legacy bool
+	// Maximum number of operations in a single batch request
+	Max_Batch_Size int
+	// Import and export of the client
+	Export_File string
+	Import_File string
+	Format      string
+	Columns     string
+	Duplicates  string
+	Dry_Run     bool
+	Deck        int
+	// Printing of flashcards
+	Print_File     string
+	Cards_Per_Page int
+	Paper          string
+	Font_File      string
+	// Minimum size of compressed responses, negative disables the compression
+	Compress_Size int
 }
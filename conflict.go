@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SERVER_NODE = "server"
+	// Clocks of clients further ahead are not trusted to order writes
+	MAX_CLOCK_SKEW = time.Minute
+)
+
+type ConflictPolicy string
+
+const (
+	// Concurrent writes of a field are ordered by their clocks
+	PolicyLastWriter ConflictPolicy = "last-writer-wins"
+	// Every concurrent write of a field is reported as conflict
+	PolicyManual ConflictPolicy = "manual"
+)
+
+func (p ConflictPolicy) valid() bool {
+	return p == PolicyLastWriter || p == PolicyManual
+}
+
+// HLC is a hybrid logical clock. It follows the wall clock, but never goes
+// backwards and orders events with the same wall time by the counter.
+// The node breaks ties between devices.
+type HLC struct {
+	Wall    int64 // milliseconds since the epoch
+	Counter int
+	Node    string
+}
+
+func (h HLC) after(other HLC) bool {
+	if h.Wall != other.Wall {
+		return h.Wall > other.Wall
+	}
+	if h.Counter != other.Counter {
+		return h.Counter > other.Counter
+	}
+	return h.Node > other.Node
+}
+
+// tick returns the clock of a local event
+func (h *HLC) tick(now time.Time) HLC {
+	if wall := now.UnixMilli(); wall > h.Wall {
+		h.Wall = wall
+		h.Counter = 0
+	} else {
+		h.Counter += 1
+	}
+	return *h
+}
+
+// observe moves the clock past a clock received from another node
+func (h *HLC) observe(remote HLC, now time.Time) {
+	wall := now.UnixMilli()
+	switch {
+	case wall > h.Wall && wall > remote.Wall:
+		h.Wall = wall
+		h.Counter = 0
+	case h.Wall == remote.Wall:
+		if remote.Counter > h.Counter {
+			h.Counter = remote.Counter
+		}
+		h.Counter += 1
+	case remote.Wall > h.Wall:
+		h.Wall = remote.Wall
+		h.Counter = remote.Counter + 1
+	default:
+		h.Counter += 1
+	}
+}
+
+func clockSkewed(clock HLC, now time.Time) bool {
+	return clock.Wall > now.Add(MAX_CLOCK_SKEW).UnixMilli()
+}
+
+var serverClock = HLC{Node: SERVER_NODE}
+
+// FieldVersion is the last write of a field: the revision of the word it
+// created and the clock of the device that made it.
+type FieldVersion struct {
+	Revision int
+	Clock    HLC
+}
+
+// serverFields are managed by the server and never changed by clients
+var serverFields = map[string]bool{
+	"ID": true, "UUID": true, "Revision": true, "Sequence": true, "Versions": true,
+	"Confidence": true, "Repeat": true, "Schedule": true, "Created": true,
+	"Deck": true, "Audio": true, "Image": true, "MergedUUIDs": true,
+}
+
+// editableFields returns the fields clients can change with their JSON values
+func editableFields(word Word) map[string]json.RawMessage {
+	raw, _ := json.Marshal(word)
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(raw, &fields)
+	for field := range serverFields {
+		delete(fields, field)
+	}
+	return fields
+}
+
+func fieldHashes(word Word) map[string]uint64 {
+	hashes := map[string]uint64{}
+	for field, value := range editableFields(word) {
+		h := fnv.New64a()
+		h.Write(value)
+		hashes[field] = h.Sum64()
+	}
+	return hashes
+}
+
+// canonicalFields renames the keys of a change to the fields of Word. JSON
+// keys are matched case-insensitively when decoding, so "translation"
+// changes Translation as well. Exact keys take precedence.
+func canonicalFields(changed map[string]json.RawMessage) map[string]json.RawMessage {
+	wordType := reflect.TypeOf(Word{})
+	result := make(map[string]json.RawMessage, len(changed))
+	for key, value := range changed {
+		name := key
+		for idx := 0; idx < wordType.NumField(); idx++ {
+			if strings.EqualFold(wordType.Field(idx).Name, key) {
+				name = wordType.Field(idx).Name
+				break
+			}
+		}
+		if _, exact := changed[name]; exact && name != key {
+			continue
+		}
+		result[name] = value
+	}
+	return result
+}
+
+func equalJSON(a json.RawMessage, b json.RawMessage) bool {
+	var left, right interface{}
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// stampFieldVersions records a new version for every field whose hash
+// changed. Fields written by a client with its own clock in this revision
+// keep that clock.
+func stampFieldVersions(word *Word, previous map[string]uint64, hashes map[string]uint64, now time.Time) {
+	versions := make(map[string]FieldVersion, len(word.Versions)+1)
+	for field, version := range word.Versions {
+		versions[field] = version
+	}
+	for field, hash := range hashes {
+		if old, ok := previous[field]; ok && old == hash {
+			continue
+		}
+		if version, ok := versions[field]; ok && version.Revision == word.Revision {
+			continue
+		}
+		versions[field] = FieldVersion{Revision: word.Revision, Clock: serverClock.tick(now)}
+	}
+	word.Versions = versions
+}
+
+// observeVersions keeps the server clock ahead of all stored clocks
+func observeVersions(word Word, now time.Time) {
+	for _, version := range word.Versions {
+		if version.Clock.after(serverClock) {
+			serverClock.observe(version.Clock, now)
+		}
+	}
+}
+
+// stampClientVersions records the clock of a client for the fields its
+// change modified. The revision is the one the word gets when it is stored.
+func stampClientVersions(word *Word, original Word, clock HLC) {
+	before := fieldHashes(original)
+	versions := make(map[string]FieldVersion, len(word.Versions)+1)
+	for field, version := range word.Versions {
+		versions[field] = version
+	}
+	for field, hash := range fieldHashes(*word) {
+		if before[field] != hash {
+			versions[field] = FieldVersion{Revision: original.Revision + 1, Clock: clock}
+		}
+	}
+	word.Versions = versions
+}
+
+// mergeFields decides which fields of a change based on an older revision
+// are applied. Fields nobody else wrote since the base revision are always
+// applied. Fields written concurrently are ordered by their clocks if both
+// writes have one and the policy allows it, the older write is discarded.
+// Otherwise there is no safe order and the field is reported as conflict.
+func mergeFields(current Word, base int, changed map[string]json.RawMessage, clock *HLC, policy ConflictPolicy) (map[string]json.RawMessage, []string, []FieldError) {
+	changed = canonicalFields(changed)
+	values := editableFields(current)
+	names := make([]string, 0, len(changed))
+	for field := range changed {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	apply := map[string]json.RawMessage{}
+	discarded := []string{}
+	conflicts := []FieldError{}
+	for _, field := range names {
+		version := current.Versions[field]
+		if serverFields[field] || version.Revision <= base {
+			apply[field] = changed[field]
+			continue
+		}
+		if equalJSON(values[field], changed[field]) {
+			continue
+		}
+		if policy == PolicyManual || clock == nil || version.Clock.Wall == 0 {
+			conflicts = append(conflicts, FieldError{"/" + field, "changed on another device"})
+			continue
+		}
+		if clock.after(version.Clock) {
+			apply[field] = changed[field]
+		} else {
+			log.Printf("Discarding older write of %s to %s", field, current.UUID)
+			discarded = append(discarded, field)
+		}
+	}
+	return apply, discarded, conflicts
+}
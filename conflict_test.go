@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHLC(t *testing.T) {
+	now := time.UnixMilli(1000)
+	clock := HLC{Node: "a"}
+	first := clock.tick(now)
+	second := clock.tick(now)
+	if !second.after(first) || second.Counter != 1 {
+		log.Printf("Clock did not advance: %+v %+v", first, second)
+		t.FailNow()
+	}
+
+	// A clock ahead of the wall clock is followed
+	clock.observe(HLC{Wall: 2000, Counter: 5, Node: "b"}, now)
+	if clock.Wall != 2000 || clock.Counter != 6 {
+		log.Printf("Remote clock not observed: %+v", clock)
+		t.FailNow()
+	}
+	if third := clock.tick(now); third.Wall != 2000 || third.Counter != 7 {
+		log.Printf("Clock went backwards: %+v", third)
+		t.Fail()
+	}
+	if !(HLC{Wall: 1, Node: "b"}).after(HLC{Wall: 1, Node: "a"}) {
+		log.Print("Node does not break ties")
+		t.Fail()
+	}
+}
+
+// conflictTestWord stores a word and changes its translation on the server,
+// so revision 1 is the base of concurrent changes.
+func conflictTestWord(t *testing.T) []Word {
+	words := syncTestWords(t)
+	words[0].Translation = "hound"
+	stampRevisions(words)
+	version := words[0].Versions["Translation"]
+	if words[0].Revision != 2 || version.Revision != 2 || version.Clock.Node != SERVER_NODE {
+		log.Printf("Version of the field not recorded: %+v", words[0])
+		t.FailNow()
+	}
+	if _, ok := words[0].Versions["Notes"]; ok {
+		log.Printf("Unchanged field has a version: %+v", words[0].Versions)
+		t.FailNow()
+	}
+	return words
+}
+
+func TestMergeFields(t *testing.T) {
+	words := conflictTestWord(t)
+	server := words[0].Versions["Translation"].Clock
+	later := HLC{Wall: server.Wall + 1, Node: "phone"}
+	earlier := HLC{Wall: server.Wall - 1, Node: "phone"}
+	changed := map[string]json.RawMessage{"Translation": json.RawMessage(`"doggy"`), "Notes": json.RawMessage(`"pet"`)}
+
+	apply, discarded, conflicts := mergeFields(words[0], 1, changed, &later, PolicyLastWriter)
+	if len(apply) != 2 || len(discarded) != 0 || len(conflicts) != 0 {
+		log.Printf("Later write did not win: %v %v %v", apply, discarded, conflicts)
+		t.Fail()
+	}
+	apply, discarded, conflicts = mergeFields(words[0], 1, changed, &earlier, PolicyLastWriter)
+	if len(apply) != 1 || len(discarded) != 1 || discarded[0] != "Translation" || len(conflicts) != 0 {
+		log.Printf("Earlier write not discarded: %v %v %v", apply, discarded, conflicts)
+		t.Fail()
+	}
+	for _, clock := range []*HLC{nil, &later} {
+		policy := PolicyManual
+		if clock == nil {
+			policy = PolicyLastWriter
+		}
+		if _, _, conflicts := mergeFields(words[0], 1, changed, clock, policy); len(conflicts) != 1 || conflicts[0].Field != "/Translation" {
+			log.Printf("Conflict not reported with %s: %v", policy, conflicts)
+			t.Fail()
+		}
+	}
+	// Keys are matched like the JSON decoder does
+	lower := map[string]json.RawMessage{"translation": json.RawMessage(`"stale"`)}
+	if _, _, conflicts := mergeFields(words[0], 1, lower, nil, PolicyLastWriter); len(conflicts) != 1 || conflicts[0].Field != "/Translation" {
+		log.Printf("Conflict of lower case key not reported: %v", conflicts)
+		t.Fail()
+	}
+	// Writing the same value is no conflict
+	same := map[string]json.RawMessage{"Translation": json.RawMessage(`"hound"`)}
+	if _, _, conflicts := mergeFields(words[0], 1, same, nil, PolicyManual); len(conflicts) != 0 {
+		t.Fail()
+	}
+}
+
+func TestSyncConcurrentEdits(t *testing.T) {
+	words := conflictTestWord(t)
+	now := time.Now()
+	later := &HLC{Wall: now.Add(time.Second).UnixMilli(), Node: "phone"}
+	changes := []struct {
+		change    SyncChange
+		status    int
+		discarded int
+	}{
+		// The notes were not changed on the server and are merged
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Notes": "pet"}`)}, http.StatusOK, 0},
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "doggy"}`)}, http.StatusConflict, 0},
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "doggy"}`), Clock: later, Policy: PolicyManual}, http.StatusConflict, 0},
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "pup"}`), Clock: &HLC{Wall: 1, Node: "tablet"}}, http.StatusOK, 1},
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "doggy"}`), Clock: later}, http.StatusOK, 0},
+		{SyncChange{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{}`), Policy: "newest"}, http.StatusBadRequest, 0},
+	}
+	for idx, test := range changes {
+		var result SyncResult
+		words, result = applySyncChange(words, test.change, false, "", now)
+		if result.Status != test.status || len(result.Discarded) != test.discarded {
+			log.Printf("Change %d: expected %d got %+v", idx, test.status, result)
+			t.Fail()
+		}
+		if result.Status == http.StatusConflict && (result.Word == nil || len(result.Error.Errors) != 1) {
+			log.Printf("Conflict %d without details: %+v", idx, result)
+			t.Fail()
+		}
+	}
+	stampRevisions(words)
+	if words[0].Translation != "doggy" || words[0].Notes != "pet" || words[0].Versions["Translation"].Clock != *later {
+		log.Printf("Unexpected merge: %+v", words[0])
+		t.Fail()
+	}
+	if !serverClock.after(*later) {
+		log.Printf("Server clock behind the client: %+v", serverClock)
+		t.Fail()
+	}
+}
+
+func TestConfidenceEventLog(t *testing.T) {
+	vocabulary = syncTestWords(t)
+	now := time.Now()
+	// The update of the second device arrives first, but was made later
+	updateConfidence([]WordConfidence{{ID: 0, Confidence: 80, Repeat: 3, Time: now.Add(-time.Minute)}}, "")
+	updateConfidence([]WordConfidence{{ID: 0, Confidence: 20, Repeat: 2, Time: now.Add(-time.Hour)}}, "")
+	if vocabulary[0].Confidence != 80 || vocabulary[0].Repeat != 3 {
+		log.Printf("Older update overwrote newer one: %+v", vocabulary[0])
+		t.Fail()
+	}
+	updateConfidence([]WordConfidence{{ID: 0, Confidence: 80, Repeat: 3, Time: now.Add(-time.Minute)}}, "")
+	if len(reviewHistory) != 2 {
+		log.Printf("Repeated update recorded again: %d", len(reviewHistory))
+		t.Fail()
+	}
+	// Lower values are accepted if they are the latest
+	updateConfidence([]WordConfidence{{ID: 0, Confidence: 10}}, "")
+	if vocabulary[0].Confidence != 10 {
+		log.Printf("Latest update not applied: %+v", vocabulary[0])
+		t.Fail()
+	}
+	// The UUID addresses the word even if the index changed in the meantime
+	updateConfidence([]WordConfidence{{ID: 0, UUID: "maus", Confidence: 60}}, "")
+	if vocabulary[2].Confidence != 60 || vocabulary[0].Confidence != 10 {
+		log.Printf("Update applied to the wrong word: %+v", vocabulary)
+		t.Fail()
+	}
+}
+
+func TestReviewConfidence(t *testing.T) {
+	vocabulary = syncTestWords(t)
+	now := time.Now()
+	reviewWord(0, WordReview{Grade: GradeGood}, "", now.Add(-time.Hour))
+	word := reviewWord(0, WordReview{Grade: GradeEasy}, "", now)
+	if word.Confidence == 0 || word.Confidence != ankiConfidence(word.Schedule.Interval) {
+		log.Printf("Confidence not derived from the review: %+v", word)
+		t.FailNow()
+	}
+	// Every review is recorded exactly once
+	if history := wordHistory(word); len(history) != 2 || history[1].Confidence != word.Confidence {
+		log.Printf("Unexpected history: %+v", history)
+		t.Fail()
+	}
+	// Forgetting the word lowers the confidence again
+	if again := reviewWord(0, WordReview{Grade: GradeAgain}, "", now.Add(time.Second)); again.Confidence >= word.Confidence {
+		log.Printf("Failed review did not lower the confidence: %d %d", again.Confidence, word.Confidence)
+		t.Fail()
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const DECK_FILE = "decks.json"
+
+// Deck groups words into a word list. In contrast to words the ID of a deck
+// is stable and never reused. Words without a deck have the deck ID 0.
+type Deck struct {
+	ID             int
+	Name           string
+	Description    string
+	SourceLanguage string
+	TargetLanguage string
+	Scheduler      string // overrides the scheduler selected by the user
+}
+
+var decks = []Deck{}
+
+// lastDeckID is the highest ID ever given to a deck, also of removed decks
+var lastDeckID = 0
+
+// deckFile is the content of DECK_FILE. Older versions stored only the list.
+type deckFile struct {
+	LastID int
+	Decks  []Deck
+}
+
+func readDecks() ([]Deck, int) {
+	log.Print("Reading existing decks")
+	content, err := os.ReadFile(DECK_FILE)
+	if err != nil || string(content) == "" {
+		log.Print("No decks found. Creating new ones...")
+		return []Deck{}, 0
+	}
+	var stored deckFile
+	if err := json.Unmarshal(content, &stored.Decks); err == nil {
+		return stored.Decks, 0
+	}
+	err = json.Unmarshal(content, &stored)
+	if err != nil || stored.Decks == nil {
+		log.Print("The given file does not contain valid decks!")
+		return []Deck{}, 0
+	}
+	return stored.Decks, stored.LastID
+}
+
+func saveDecks(list []Deck) {
+	log.Print("Storing the decks")
+	rawData, err := json.MarshalIndent(deckFile{lastDeckID, list}, "", "\t")
+	if err != nil {
+		log.Print("Failed to convert decks to JSON!")
+		return
+	}
+	err = os.WriteFile(DECK_FILE, rawData, 0644)
+	if err != nil {
+		log.Printf("Failed to write file \"%s\"", DECK_FILE)
+	}
+}
+
+// nextDeckID reserves a new ID, the decks must be saved afterwards
+func nextDeckID() int {
+	for _, deck := range decks {
+		if deck.ID > lastDeckID {
+			lastDeckID = deck.ID
+		}
+	}
+	lastDeckID += 1
+	return lastDeckID
+}
+
+func findDeck(id int) (int, bool) {
+	for idx, deck := range decks {
+		if deck.ID == id {
+			return idx, true
+		}
+	}
+	return -1, false
+}
+
+// deckExists reports whether words may be assigned to the given deck.
+func deckExists(id int) bool {
+	if id == 0 {
+		return true
+	}
+	_, ok := findDeck(id)
+	return ok
+}
+
+func wordsInDeck(words []Word, id int) []Word {
+	list := []Word{}
+	for _, word := range words {
+		if word.Deck == id {
+			list = append(list, word)
+		}
+	}
+	return list
+}
+
+// schedulerForWord returns the scheduler of the deck the word belongs to or
+// the scheduler selected by the user if the deck does not define one.
+func schedulerForWord(user string, word Word) Scheduler {
+	if idx, ok := findDeck(word.Deck); ok {
+		if s, ok := lookupScheduler(decks[idx].Scheduler); ok {
+			return s
+		}
+	}
+	return schedulerForUser(user)
+}
+
+// deckFilter reads the optional "deck" query parameter used to restrict
+// requests to a single deck. A missing parameter returns -1.
+func deckFilter(c *gin.Context) (int, bool) {
+	param, ok := c.GetQuery("deck")
+	if !ok {
+		return -1, true
+	}
+	id, err := strconv.Atoi(param)
+	if err != nil || !deckExists(id) {
+		return -1, false
+	}
+	return id, true
+}
+
+func validateDeck(deck Deck) []FieldError {
+	errors := []FieldError{}
+	if deck.Name == "" {
+		errors = append(errors, FieldError{"/Name", "deck name is missing"})
+	}
+	if !validLanguage(deck.SourceLanguage) {
+		errors = append(errors, FieldError{"/SourceLanguage", "invalid language code"})
+	}
+	if !validLanguage(deck.TargetLanguage) {
+		errors = append(errors, FieldError{"/TargetLanguage", "invalid language code"})
+	}
+	if _, ok := lookupScheduler(deck.Scheduler); deck.Scheduler != "" && !ok {
+		errors = append(errors, FieldError{"/Scheduler", "unknown scheduler"})
+	}
+	return errors
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getDecks(c *gin.Context) {
+	respond(c, http.StatusOK, decks)
+}
+
+func postDeck(c *gin.Context) {
+	var newDeck Deck
+	if err := c.ShouldBindJSON(&newDeck); err != nil {
+		log.Printf("Deck is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid deck")
+		return
+	}
+	newDeck.SourceLanguage = normalizeLanguage(newDeck.SourceLanguage)
+	newDeck.TargetLanguage = normalizeLanguage(newDeck.TargetLanguage)
+	if errors := validateDeck(newDeck); len(errors) > 0 {
+		respondValidationProblem(c, errors)
+		return
+	}
+	newDeck.ID = nextDeckID()
+	decks = append(decks, newDeck)
+	saveDecks(decks)
+	respond(c, http.StatusCreated, newDeck)
+}
+
+func getDeck(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	idx, ok := findDeck(compare)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	respond(c, http.StatusOK, decks[idx])
+}
+
+func modifyDeck(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	idx, ok := findDeck(compare)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	var updatedDeck Deck
+	if err := c.ShouldBindJSON(&updatedDeck); err != nil {
+		log.Printf("Failed to bind to Deck: %s", err)
+		respondBindError(c, err, "invalid deck")
+		return
+	}
+	updatedDeck.SourceLanguage = normalizeLanguage(updatedDeck.SourceLanguage)
+	updatedDeck.TargetLanguage = normalizeLanguage(updatedDeck.TargetLanguage)
+	if errors := validateDeck(updatedDeck); len(errors) > 0 {
+		respondValidationProblem(c, errors)
+		return
+	}
+	updatedDeck.ID = compare
+	decks[idx] = updatedDeck
+	log.Printf("Updated deck %d to %+v", compare, updatedDeck)
+	saveDecks(decks)
+	respond(c, http.StatusOK, updatedDeck)
+}
+
+// removeDeck deletes the deck itself. Its words are kept without a deck.
+func removeDeck(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	idx, ok := findDeck(compare)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	for wordIdx := range vocabulary {
+		if vocabulary[wordIdx].Deck == compare {
+			vocabulary[wordIdx].Deck = 0
+		}
+	}
+	decks = append(decks[:idx], decks[idx+1:]...)
+	log.Printf("Removed deck %d", compare)
+	saveVocabularyV2(&vocabulary)
+	saveDecks(decks)
+	respond(c, http.StatusOK, decks)
+}
+
+func getDeckWords(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	if _, ok := findDeck(compare); !ok {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	respond(c, http.StatusOK, wordsInDeck(vocabulary, compare))
+}
+
+// moveDeckWords moves the words with the given IDs into the deck. Moving
+// words to deck 0 removes them from their current deck.
+func moveDeckWords(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	if !deckExists(compare) {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	var wordIds []int
+	if err := c.ShouldBindJSON(&wordIds); err != nil {
+		log.Printf("Word list is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid word list")
+		return
+	}
+	for _, id := range wordIds {
+		if id >= len(vocabulary) || id < 0 {
+			respondProblem(c, http.StatusBadRequest, ErrWordNotFound, "given index does not exist")
+			return
+		}
+	}
+	for _, id := range wordIds {
+		vocabulary[id].Deck = compare
+	}
+	log.Printf("Moved %d words into deck %d", len(wordIds), compare)
+	saveVocabularyV2(&vocabulary)
+	respond(c, http.StatusOK, wordsInDeck(vocabulary, compare))
+}
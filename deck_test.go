@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+func TestDeckScheduler(t *testing.T) {
+	decks = []Deck{
+		{ID: 1, Name: "Spanish", Scheduler: "leitner"},
+		{ID: 3, Name: "Travel"},
+	}
+	lastDeckID = 0
+	userSettings = map[string]UserSettings{"lerner": {Scheduler: "fsrs"}}
+	expected := map[int]string{0: "fsrs", 1: "leitner", 3: "fsrs", 7: "fsrs"}
+	for deck, name := range expected {
+		if scheduler := schedulerForWord("lerner", Word{Deck: deck}); scheduler.Name() != name {
+			log.Printf("Deck %d: expected %s got %s", deck, name, scheduler.Name())
+			t.Fail()
+		}
+	}
+	if nextDeckID() != 4 || !deckExists(0) || deckExists(2) {
+		t.FailNow()
+	}
+}
+
+func TestDeckIDsNotReused(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+
+	// Decks stored by older versions are a plain list
+	os.WriteFile(DECK_FILE, []byte(`[{"ID": 1, "Name": "Spanish"}, {"ID": 2, "Name": "Travel"}]`), 0644)
+	decks, lastDeckID = readDecks()
+	if len(decks) != 2 || nextDeckID() != 3 {
+		log.Printf("Old decks not read: %+v %d", decks, lastDeckID)
+		t.FailNow()
+	}
+	// The IDs of removed decks are not given out again, also after a restart
+	decks = decks[:1]
+	saveDecks(decks)
+	decks, lastDeckID = readDecks()
+	if len(decks) != 1 || nextDeckID() != 4 {
+		log.Printf("Deck ID reused: %+v %d", decks, lastDeckID)
+		t.Fail()
+	}
+}
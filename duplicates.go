@@ -0,0 +1,198 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MergeRequest struct {
+	Target  int
+	Sources []int
+}
+
+// duplicateKey identifies words that only differ in whitespace, case or
+// Unicode composition. Words in different source languages never collide.
+func duplicateKey(word Word) string {
+	source, _ := wordLanguages(word)
+	return source + "|" + strings.ToLower(normalizeAnswer(word.Vocabulary))
+}
+
+func findDuplicate(words []Word, word Word) (int, bool) {
+	key := duplicateKey(word)
+	for idx := range words {
+		if duplicateKey(words[idx]) == key {
+			return idx, true
+		}
+	}
+	return -1, false
+}
+
+// duplicateClusters groups all words sharing the same duplicate key. Only
+// groups with more than one word are returned.
+func duplicateClusters(words []Word) [][]Word {
+	groups := map[string][]Word{}
+	order := []string{}
+	for _, word := range words {
+		key := duplicateKey(word)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], word)
+	}
+	clusters := [][]Word{}
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			clusters = append(clusters, groups[key])
+		}
+	}
+	return clusters
+}
+
+func appendMissing(list []string, entries ...string) []string {
+	for _, entry := range entries {
+		found := false
+		for _, existing := range list {
+			found = found || strings.EqualFold(existing, entry)
+		}
+		if !found {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// mergeWords combines the source words into the target. Fields of the target
+// take precedence, missing fields and lists are filled from the sources and
+// differing translations are kept as additional accepted answers.
+func mergeWords(target Word, sources []Word) Word {
+	merged := cloneWord(target)
+	answers := acceptedAnswers(merged.Translation)
+	for _, source := range sources {
+		answers = appendMissing(answers, acceptedAnswers(source.Translation)...)
+		merged.Tags = append(merged.Tags, source.Tags...)
+		merged.Synonyms = appendMissing(merged.Synonyms, source.Synonyms...)
+		merged.Antonyms = appendMissing(merged.Antonyms, source.Antonyms...)
+		for _, example := range source.Examples {
+			found := false
+			for _, existing := range merged.Examples {
+				found = found || existing.Sentence == example.Sentence
+			}
+			if !found {
+				merged.Examples = append(merged.Examples, example)
+			}
+		}
+		for language, text := range source.Translations {
+			if _, ok := merged.Translations[language]; !ok {
+				merged.Translations[language] = text
+			}
+		}
+		fields := []struct {
+			target *string
+			source string
+		}{
+			{&merged.PartOfSpeech, source.PartOfSpeech},
+			{&merged.Gender, source.Gender},
+			{&merged.Article, source.Article},
+			{&merged.Plural, source.Plural},
+			{&merged.SourceLanguage, source.SourceLanguage},
+			{&merged.TargetLanguage, source.TargetLanguage},
+			{&merged.Audio, source.Audio},
+			{&merged.Image, source.Image},
+		}
+		for _, field := range fields {
+			if *field.target == "" {
+				*field.target = field.source
+			}
+		}
+		if source.Notes != "" && !strings.Contains(merged.Notes, source.Notes) {
+			merged.Notes = strings.TrimSpace(merged.Notes + "\n" + source.Notes)
+		}
+		if source.Confidence > merged.Confidence {
+			merged.Confidence = source.Confidence
+		}
+		if source.Repeat > merged.Repeat {
+			merged.Repeat = source.Repeat
+		}
+		if !source.Created.IsZero() && (merged.Created.IsZero() || source.Created.Before(merged.Created)) {
+			merged.Created = source.Created
+		}
+		merged.MergedUUIDs = append(merged.MergedUUIDs, source.UUID)
+		merged.MergedUUIDs = append(merged.MergedUUIDs, source.MergedUUIDs...)
+	}
+	merged.Translation = strings.Join(answers, "; ")
+	normalizeWord(&merged)
+	return merged
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getDuplicates(c *gin.Context) {
+	respond(c, http.StatusOK, duplicateClusters(vocabulary))
+}
+
+// mergeDataItems combines the sources into the target and removes them. The
+// If-Match header must list the ETags of all of these words.
+func mergeDataItems(c *gin.Context) {
+	var request MergeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("Merge request is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid merge request")
+		return
+	}
+	if len(request.Sources) == 0 {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "no words to merge given")
+		return
+	}
+	seen := map[int]bool{request.Target: true}
+	for _, id := range append(request.Sources, request.Target) {
+		if id >= len(vocabulary) || id < 0 {
+			respondProblem(c, http.StatusBadRequest, ErrWordNotFound, "given index does not exist")
+			return
+		}
+	}
+	sources := []Word{}
+	for _, id := range request.Sources {
+		if seen[id] {
+			respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "words can only be merged once")
+			return
+		}
+		seen[id] = true
+		sources = append(sources, vocabulary[id])
+	}
+	for _, word := range append(sources, vocabulary[request.Target]) {
+		if !checkIfMatch(c, word) {
+			return
+		}
+	}
+
+	merged := mergeWords(vocabulary[request.Target], sources)
+	// The combined history describes the learning progress best, unless none
+	// of the words were reviewed so far
+	replayed := replaySchedule(wordHistory(merged), schedulerForWord(userFromContext(c), merged))
+	if !replayed.LastReview.IsZero() {
+		merged.Schedule = replayed
+	}
+
+	vocabulary[request.Target] = merged
+	removed := append([]int{}, request.Sources...)
+	sort.Sort(sort.Reverse(sort.IntSlice(removed)))
+	for _, id := range removed {
+		vocabulary = append(vocabulary[:id], vocabulary[id+1:]...)
+	}
+	for _, source := range sources {
+		searchIndex.remove(source.UUID)
+		cleanupMedia(source.Audio, source.Image)
+	}
+	searchIndex.add(merged)
+
+	log.Printf("Merged %d words into %s", len(sources), merged.UUID)
+	saveVocabularyV2(&vocabulary)
+	idx := indexOfUUID(vocabulary, merged.UUID)
+	respond(c, http.StatusOK, vocabulary[idx])
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDuplicateDetection(t *testing.T) {
+	decks = []Deck{}
+	words := []Word{
+		{UUID: "a", Vocabulary: "Hund"},
+		{UUID: "b", Vocabulary: "hund "},
+		{UUID: "c", Vocabulary: "Katze"},
+		{UUID: "d", Vocabulary: "Hund", SourceLanguage: "sv"},
+		{UUID: "e", Vocabulary: " HUND"},
+	}
+	if idx, found := findDuplicate(words, Word{Vocabulary: "  hUnd"}); !found || idx != 0 {
+		log.Printf("Duplicate not found: %d", idx)
+		t.FailNow()
+	}
+	if _, found := findDuplicate(words, Word{Vocabulary: "Maus"}); found {
+		t.FailNow()
+	}
+	clusters := duplicateClusters(words)
+	if len(clusters) != 1 || len(clusters[0]) != 3 || clusters[0][2].UUID != "e" {
+		log.Printf("Unexpected clusters: %+v", clusters)
+		t.FailNow()
+	}
+}
+
+func TestMergeWords(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	target := Word{UUID: "a", Vocabulary: "Hund", Translation: "dog", Confidence: 20, Tags: []string{"animal"}}
+	sources := []Word{
+		{UUID: "b", Vocabulary: "hund", Translation: "Dog/hound", Confidence: 60, Created: created, Tags: []string{"chapter-1"}, PartOfSpeech: "noun", Notes: "m"},
+		{UUID: "c", Vocabulary: "Hund ", Translation: "dog", Synonyms: []string{"Köter"}, MergedUUIDs: []string{"z"}},
+	}
+	merged := mergeWords(target, sources)
+	if merged.UUID != "a" || merged.Vocabulary != "Hund" || merged.Translation != "dog; hound" {
+		log.Printf("Unexpected merge result: %+v", merged)
+		t.FailNow()
+	}
+	if merged.Confidence != 60 || !merged.Created.Equal(created) || merged.PartOfSpeech != "noun" || merged.Notes != "m" {
+		log.Printf("Fields not taken over: %+v", merged)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(merged.Tags, []string{"animal", "chapter-1"}) || !reflect.DeepEqual(merged.MergedUUIDs, []string{"b", "c", "z"}) {
+		log.Printf("Lists not merged: %+v", merged)
+		t.FailNow()
+	}
+
+	// The history of merged words belongs to the merged word
+	reviewHistory = []ReviewEvent{
+		{WordUUID: "b", Time: created, Grade: GradeGood},
+		{WordUUID: "z", Time: created.AddDate(0, 0, 1), Grade: GradeGood},
+		{WordUUID: "x", Time: created, Grade: GradeGood},
+	}
+	if len(wordHistory(merged)) != 2 {
+		log.Printf("Unexpected history: %+v", wordHistory(merged))
+		t.FailNow()
+	}
+}
+
+func TestMergeDataItemsPreconditions(t *testing.T) {
+	vocabulary = syncTestWords(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/words/merge", mergeDataItems)
+	all := wordETag(vocabulary[0]) + ", " + wordETag(vocabulary[1])
+	cases := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusPreconditionRequired},
+		// The removed word must be named as well
+		{wordETag(vocabulary[0]), http.StatusPreconditionFailed},
+		{all, http.StatusOK},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/words/merge", strings.NewReader(`{"Target": 0, "Sources": [1]}`))
+		if test.header != "" {
+			req.Header.Set("If-Match", test.header)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != test.status {
+			log.Printf("If-Match %q: expected %d got %d", test.header, test.status, w.Code)
+			t.Fail()
+		}
+	}
+	if len(vocabulary) != 2 {
+		log.Printf("Words not merged once: %d", len(vocabulary))
+		t.Fail()
+	}
+}
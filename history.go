@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const HISTORY_FILE = "history.jsonl"
+
+type Direction string
+
+const (
+	DirectionForward Direction = "forward" // Vocabulary -> Translation
+	DirectionReverse Direction = "reverse" // Translation -> Vocabulary
+)
+
+func (d Direction) valid() bool {
+	return d == DirectionForward || d == DirectionReverse
+}
+
+// ReviewEvent is a single answer given for a word. Events are only ever
+// appended to the history and never modified afterwards.
+type ReviewEvent struct {
+	WordUUID     string
+	User         string
+	Time         time.Time
+	Grade        Grade
+	ResponseTime int // in milliseconds
+	Direction    Direction
+	Confidence   int
+}
+
+var reviewHistory = []ReviewEvent{}
+
+// uuidPattern matches the UUIDs of newUUID and the ones clients generate
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+func newUUID() string {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		log.Fatalf("Failed to generate uuid: %s", err)
+	}
+	return hex.EncodeToString(raw)
+}
+
+// assignWordUUIDs gives every word without a stable identifier a new one.
+// The ID of a word is its index and changes whenever a word is removed.
+func assignWordUUIDs(list *[]Word) {
+	for idx := range *list {
+		if (*list)[idx].UUID == "" {
+			(*list)[idx].UUID = newUUID()
+		}
+	}
+}
+
+func readHistory() []ReviewEvent {
+	log.Print("Reading existing review history")
+	f, err := os.Open(HISTORY_FILE)
+	if err != nil {
+		log.Print("No review history found. Creating new one...")
+		return []ReviewEvent{}
+	}
+	defer f.Close()
+	history := []ReviewEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event ReviewEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("Skipping invalid review event: %s", err)
+			continue
+		}
+		history = append(history, event)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read review history: %s", err)
+	}
+	return history
+}
+
+func appendHistory(events []ReviewEvent) error {
+	f, err := os.OpenFile(HISTORY_FILE, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open file \"%s\"", HISTORY_FILE)
+		return err
+	}
+	defer f.Close()
+	for _, event := range events {
+		raw, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(raw, '\n')); err != nil {
+			return err
+		}
+	}
+	reviewHistory = append(reviewHistory, events...)
+	return nil
+}
+
+func recordReviews(events ...ReviewEvent) {
+	if err := appendHistory(events); err != nil {
+		log.Printf("Failed to record review history: %s", err)
+	}
+}
+
+// wordHistory returns the events of the word including the events of all
+// words that were merged into it.
+func wordHistory(word Word) []ReviewEvent {
+	uuids := map[string]bool{word.UUID: true}
+	for _, merged := range word.MergedUUIDs {
+		uuids[merged] = true
+	}
+	events := []ReviewEvent{}
+	for _, event := range reviewHistory {
+		if uuids[event.WordUUID] {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+// applyReview records a review of the word and updates its schedule and
+// confidence. Reviews given offline may arrive after later ones, then the
+// schedule is replayed from the history instead.
+func applyReview(word *Word, review WordReview, user string, at time.Time) {
+	scheduler := schedulerForWord(user, *word)
+	log.Printf("Reviewing word %s with grade %d using %s", word.UUID, review.Grade, scheduler.Name())
+	event := ReviewEvent{
+		WordUUID:     word.UUID,
+		User:         user,
+		Time:         at,
+		Grade:        review.Grade,
+		ResponseTime: review.ResponseTime,
+		Direction:    review.Direction,
+	}
+	history := wordHistory(*word)
+	if len(history) > 0 && history[len(history)-1].Time.After(at) {
+		history = append(history, event)
+		sort.SliceStable(history, func(i, j int) bool {
+			return history[i].Time.Before(history[j].Time)
+		})
+		word.Schedule = replaySchedule(history, scheduler)
+	} else {
+		word.Schedule = scheduler.Next(word.Schedule, review.Grade, at)
+	}
+	// The interval the grade led to is mapped onto the confidence like the
+	// one of imported Anki cards
+	word.Confidence = ankiConfidence(word.Schedule.Interval)
+	event.Confidence = word.Confidence
+	recordReviews(event)
+}
+
+func confidenceRecorded(uuid string, at time.Time, confidence int) bool {
+	for _, event := range reviewHistory {
+		if event.WordUUID == uuid && !event.Grade.valid() && event.Time.Equal(at) && event.Confidence == confidence {
+			return true
+		}
+	}
+	return false
+}
+
+// latestConfidence returns the confidence of the latest confidence update in
+// the sorted events, or the current confidence if there is none.
+func latestConfidence(events []ReviewEvent, current int) int {
+	for idx := len(events) - 1; idx >= 0; idx-- {
+		if !events[idx].Grade.valid() {
+			return events[idx].Confidence
+		}
+	}
+	return current
+}
+
+// replaySchedule recomputes the scheduling state of a word from its history.
+// Events without a grade (plain confidence updates) do not affect the result.
+func replaySchedule(events []ReviewEvent, scheduler Scheduler) Schedule {
+	state := Schedule{}
+	for _, event := range events {
+		if !event.Grade.valid() {
+			continue
+		}
+		state = scheduler.Next(state, event.Grade, event.Time)
+	}
+	return state
+}
+
+func rebuildSchedules(user string) {
+	log.Printf("Rebuilding schedules from history for %s", user)
+	for idx := range vocabulary {
+		scheduler := schedulerForWord(user, vocabulary[idx])
+		vocabulary[idx].Schedule = replaySchedule(wordHistory(vocabulary[idx]), scheduler)
+	}
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getWordHistory(c *gin.Context) {
+	id := c.Param("id")
+	compare, _ := strconv.Atoi(id)
+	if compare >= len(vocabulary) || compare < 0 {
+		respondProblem(c, http.StatusNotFound, ErrWordNotFound, "word not found")
+		return
+	}
+	respond(c, http.StatusOK, wordHistory(vocabulary[compare]))
+}
+
+func rebuildFromHistory(c *gin.Context) {
+	rebuildSchedules(userFromContext(c))
+	saveVocabularyV2(&vocabulary)
+	respond(c, http.StatusOK, vocabulary)
+}
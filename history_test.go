@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+
+	reviewHistory = []ReviewEvent{}
+	events := []ReviewEvent{
+		{WordUUID: "a", User: "lerner", Time: reviewStart.AddDate(0, 0, 1), Grade: GradeGood, Direction: DirectionForward},
+		{WordUUID: "b", User: "lerner", Time: reviewStart, Confidence: 50},
+		{WordUUID: "a", User: "lerner", Time: reviewStart, Grade: GradeAgain, Direction: DirectionReverse},
+	}
+	recordReviews(events...)
+	stored := readHistory()
+	if len(stored) != len(events) {
+		log.Printf("Expected %d events got %d", len(events), len(stored))
+		t.FailNow()
+	}
+	for idx := range events {
+		if !stored[idx].Time.Equal(events[idx].Time) || stored[idx].WordUUID != events[idx].WordUUID || stored[idx].Grade != events[idx].Grade {
+			log.Printf("Expected %+v got %+v", events[idx], stored[idx])
+			t.FailNow()
+		}
+	}
+
+	// The history is returned in chronological order
+	history := wordHistory(Word{UUID: "a"})
+	if len(history) != 2 || history[0].Grade != GradeAgain {
+		log.Printf("Unexpected history: %+v", history)
+		t.FailNow()
+	}
+}
+
+func TestReplaySchedule(t *testing.T) {
+	sm2 := SM2Scheduler{}
+	expected := sm2.Next(Schedule{}, GradeGood, reviewStart)
+	expected = sm2.Next(expected, GradeEasy, expected.Due)
+
+	events := []ReviewEvent{
+		{Time: reviewStart, Grade: GradeGood},
+		{Time: reviewStart.AddDate(0, 0, 1), Confidence: 30},
+		{Time: expected.LastReview, Grade: GradeEasy},
+	}
+	if replaySchedule(events, sm2) != expected {
+		log.Printf("Replayed schedule does not match: %+v", replaySchedule(events, sm2))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Languages are identified by their ISO 639-1 (two letter) or ISO 639-2/3
+// (three letter) code, e.g. "de", "es" or "gsw".
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+func normalizeLanguage(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+func validLanguage(code string) bool {
+	return code == "" || languageCodePattern.MatchString(code)
+}
+
+func normalizeTranslations(translations map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for language, text := range translations {
+		normalized[normalizeLanguage(language)] = strings.TrimSpace(text)
+	}
+	return normalized
+}
+
+// wordLanguages returns the source and target language of the primary
+// translation. Languages missing on the word are taken from its deck.
+func wordLanguages(word Word) (string, string) {
+	source, target := word.SourceLanguage, word.TargetLanguage
+	if idx, ok := findDeck(word.Deck); ok {
+		if source == "" {
+			source = decks[idx].SourceLanguage
+		}
+		if target == "" {
+			target = decks[idx].TargetLanguage
+		}
+	}
+	return source, target
+}
+
+// translationInto returns the translation of the word into the given
+// language, looking at the primary translation first.
+func translationInto(word Word, language string) (string, bool) {
+	if _, target := wordLanguages(word); target == language && word.Translation != "" {
+		return word.Translation, true
+	}
+	text, ok := word.Translations[language]
+	return text, ok && text != ""
+}
+
+// translateWord returns the word with the translation into the given language
+// as its primary translation. Clients only knowing a single translation can
+// use the shared vocabulary this way.
+func translateWord(word Word, language string) Word {
+	text, ok := translationInto(word, language)
+	if !ok {
+		return word
+	}
+	word.SourceLanguage, _ = wordLanguages(word)
+	word.Translation = text
+	word.TargetLanguage = language
+	return word
+}
+
+func validateLanguages(word Word) []FieldError {
+	errors := []FieldError{}
+	if !validLanguage(word.SourceLanguage) {
+		errors = append(errors, FieldError{"/SourceLanguage", "invalid language code"})
+	}
+	if !validLanguage(word.TargetLanguage) {
+		errors = append(errors, FieldError{"/TargetLanguage", "invalid language code"})
+	}
+	languages := make([]string, 0, len(word.Translations))
+	for language := range word.Translations {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		field := "/Translations/" + language
+		if language == "" || !validLanguage(language) {
+			errors = append(errors, FieldError{field, "invalid language code"})
+		} else if word.Translations[language] == "" {
+			errors = append(errors, FieldError{field, "translation is missing"})
+		}
+	}
+	return errors
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestLanguageFilter(t *testing.T) {
+	decks = []Deck{{ID: 1, Name: "Spanish", SourceLanguage: "de", TargetLanguage: "es"}}
+	words := []Word{
+		{Vocabulary: "der Hund", Translation: "el perro", Deck: 1, Translations: map[string]string{"it": "il cane"}},
+		{Vocabulary: "die Katze", Translation: "the cat", SourceLanguage: "de", TargetLanguage: "en", Translations: map[string]string{"es": "el gato"}},
+		{Vocabulary: "the house", Translation: "das Haus", SourceLanguage: "en", TargetLanguage: "de"},
+	}
+	cases := []struct {
+		filter   WordFilter
+		expected []int
+	}{
+		{WordFilter{Deck: -1, From: "de"}, []int{0, 1}},
+		{WordFilter{Deck: -1, From: "de", To: "es"}, []int{0, 1}},
+		{WordFilter{Deck: -1, To: "it"}, []int{0}},
+		{WordFilter{Deck: -1, From: "en", To: "es"}, []int{}},
+	}
+	for _, test := range cases {
+		if result := filterWords(words, test.filter); !reflect.DeepEqual(result, test.expected) {
+			log.Printf("Filter %+v: expected %v got %v", test.filter, test.expected, result)
+			t.Fail()
+		}
+	}
+
+	translated := translateWord(words[1], "es")
+	if translated.Translation != "el gato" || translated.SourceLanguage != "de" || translated.TargetLanguage != "es" {
+		log.Printf("Unexpected translation: %+v", translated)
+		t.FailNow()
+	}
+	if translateWord(words[0], "es").Translation != "el perro" {
+		t.FailNow()
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	if len(validateLanguages(Word{SourceLanguage: "de", Translations: map[string]string{"gsw": "Hund"}})) != 0 {
+		t.FailNow()
+	}
+	errors := validateLanguages(Word{SourceLanguage: "german", Translations: map[string]string{"es": ""}})
+	if len(errors) != 2 || errors[0].Field != "/SourceLanguage" || errors[1].Field != "/Translations/es" {
+		t.FailNow()
+	}
+}
@@ -15,19 +15,47 @@ func main() {
 	overwrite := flag.Bool("e", false, "Overwrite the existing vocabulary")
 	client := flag.Bool("c", false, "If set start as client and make request")
 	token := flag.Bool("t", false, "If set a new token is generated")
+	legacy := flag.Bool("l", false, "Keep the legacy routes and full vocabulary responses for older clients")
+	batchSize := flag.Int("b", MAX_BATCH_SIZE, "Maximum number of operations in a batch request")
+	exportFile := flag.String("export", "", "Export the vocabulary into the given file")
+	importFile := flag.String("import", "", "Import the vocabulary from the given file")
+	format := flag.String("format", "csv", "Format of the import or export file (csv, tsv, quizlet or apkg)")
+	deck := flag.Int("deck", -1, "Deck to export, import into or print, all decks if negative (not for printing)")
+	columns := flag.String("columns", "", "Column mapping of the import, e.g. vocabulary=Wort,translation=Meaning")
+	duplicates := flag.String("duplicates", "skip", "Handling of duplicates during the import (skip, update or create)")
+	dryRun := flag.Bool("dry", false, "Only report what the import would change")
+	printFile := flag.String("print", "", "Print the flashcards of the deck into the given PDF file")
+	cards := flag.Int("cards", DEFAULT_CARDS_PER_PAGE, "Number of flashcards per page")
+	paper := flag.String("paper", DEFAULT_PAPER, "Paper size of the flashcards (a4 or letter)")
+	font := flag.String("font", "", "TrueType font embedded into printed flashcards")
+	compress := flag.Int("compress", MIN_COMPRESS_SIZE, "Minimum size in bytes of compressed responses, negative disables the compression")
 	flag.Parse()
 
 	configuration := Configuration{
-		IP_Address:  *addr,
-		Listen_Port: *port,
-		Overwrite:   *overwrite,
-		Client:      *client,
-		Token:       *token,
+		IP_Address:     *addr,
+		Listen_Port:    *port,
+		Overwrite:      *overwrite,
+		Client:         *client,
+		Token:          *token,
+		Legacy:         *legacy,
+		Max_Batch_Size: *batchSize,
+		Export_File:    *exportFile,
+		Import_File:    *importFile,
+		Format:         *format,
+		Columns:        *columns,
+		Duplicates:     *duplicates,
+		Dry_Run:        *dryRun,
+		Deck:           *deck,
+		Print_File:     *printFile,
+		Cards_Per_Page: *cards,
+		Paper:          *paper,
+		Font_File:      *font,
+		Compress_Size:  *compress,
 	}
 
 	// Starting the main server and waiting for request
 	// net.Listen()
-	if configuration.Client {
+	if configuration.Client || configuration.Export_File != "" || configuration.Import_File != "" || configuration.Print_File != "" {
 		startingClient(configuration)
 	} else {
 		startingServer(configuration)
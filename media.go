@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MEDIA_DIRECTORY  = "media"
+	MAX_AUDIO_SIZE   = 5 << 20
+	MAX_IMAGE_SIZE   = 2 << 20
+	MEDIA_CACHE_TIME = 365 * 24 * 60 * 60
+)
+
+var allowedAudioTypes = map[string]bool{
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"audio/aiff":      true,
+	"audio/basic":     true,
+	"application/ogg": true,
+}
+
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var mediaHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func mediaPath(hash string) string {
+	return filepath.Join(MEDIA_DIRECTORY, hash)
+}
+
+// storeMedia writes the uploaded file into the media directory. Files are
+// named after the SHA-256 of their content, so storing the same file twice
+// does not take any additional space.
+func storeMedia(header *multipart.FileHeader, maxSize int64, allowed map[string]bool) (string, *Problem) {
+	if header.Size > maxSize {
+		return "", newProblem(http.StatusRequestEntityTooLarge, ErrPayloadTooLarge, "file too large")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return "", newProblem(http.StatusBadRequest, ErrMalformedBody, "failed to read file")
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return "", newProblem(http.StatusBadRequest, ErrMalformedBody, "failed to read file")
+	}
+	return storeMediaContent(content, maxSize, allowed)
+}
+
+// storeMediaContent stores media that was not uploaded as a form file, like
+// the media of imported packages.
+func storeMediaContent(content []byte, maxSize int64, allowed map[string]bool) (string, *Problem) {
+	if int64(len(content)) > maxSize {
+		return "", newProblem(http.StatusRequestEntityTooLarge, ErrPayloadTooLarge, "file too large")
+	}
+	if mimeType := http.DetectContentType(content); !allowed[mimeType] {
+		log.Printf("Rejected media of type %s", mimeType)
+		return "", newProblem(http.StatusUnsupportedMediaType, ErrUnsupportedMediaType, "unsupported media type")
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if _, err := os.Stat(mediaPath(hash)); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(MEDIA_DIRECTORY, 0755); err != nil {
+		log.Printf("Failed to create media directory: %s", err)
+		return "", newProblem(http.StatusInternalServerError, ErrInternal, "failed to store file")
+	}
+	// Write to a temporary file first so a crash never leaves a partial file
+	// under the final name
+	tmp := mediaPath(hash) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		log.Printf("Failed to write media file: %s", err)
+		return "", newProblem(http.StatusInternalServerError, ErrInternal, "failed to store file")
+	}
+	if err := os.Rename(tmp, mediaPath(hash)); err != nil {
+		log.Printf("Failed to rename media file: %s", err)
+		return "", newProblem(http.StatusInternalServerError, ErrInternal, "failed to store file")
+	}
+	log.Printf("Stored media %s", hash)
+	return hash, nil
+}
+
+func mediaReferenced(hash string) bool {
+	for _, word := range vocabulary {
+		if word.Audio == hash || word.Image == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupMedia removes the given media files unless another word still uses
+// the same content.
+func cleanupMedia(hashes ...string) {
+	for _, hash := range hashes {
+		if hash == "" || mediaReferenced(hash) {
+			continue
+		}
+		if err := os.Remove(mediaPath(hash)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove media %s: %s", hash, err)
+			continue
+		}
+		log.Printf("Removed media %s", hash)
+	}
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func uploadMedia(c *gin.Context) {
+	id := c.Param("id")
+	compare, _ := strconv.Atoi(id)
+	if compare >= len(vocabulary) || compare < 0 {
+		respondProblem(c, http.StatusNotFound, ErrWordNotFound, "word not found")
+		return
+	}
+	if !checkIfMatch(c, vocabulary[compare]) {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MAX_AUDIO_SIZE+MAX_IMAGE_SIZE+(1<<20))
+	audio, audioErr := c.FormFile("audio")
+	image, imageErr := c.FormFile("image")
+	if audioErr != nil && imageErr != nil {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "neither audio nor image given")
+		return
+	}
+
+	previous := vocabulary[compare]
+	word := vocabulary[compare]
+	if audioErr == nil {
+		hash, problem := storeMedia(audio, MAX_AUDIO_SIZE, allowedAudioTypes)
+		if problem != nil {
+			writeProblem(c, problem)
+			return
+		}
+		word.Audio = hash
+	}
+	if imageErr == nil {
+		hash, problem := storeMedia(image, MAX_IMAGE_SIZE, allowedImageTypes)
+		if problem != nil {
+			cleanupMedia(word.Audio)
+			writeProblem(c, problem)
+			return
+		}
+		word.Image = hash
+	}
+	vocabulary[compare] = word
+	saveVocabularyV2(&vocabulary)
+	cleanupMedia(previous.Audio, previous.Image)
+	respond(c, http.StatusOK, vocabulary[compare])
+}
+
+func getMedia(c *gin.Context) {
+	hash := c.Param("hash")
+	if !mediaHashPattern.MatchString(hash) {
+		respondProblem(c, http.StatusNotFound, ErrMediaNotFound, "media not found")
+		return
+	}
+	f, err := os.Open(mediaPath(hash))
+	if err != nil {
+		respondProblem(c, http.StatusNotFound, ErrMediaNotFound, "media not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondProblem(c, http.StatusInternalServerError, ErrInternal, "failed to read media")
+		return
+	}
+
+	// The content never changes for a given hash
+	c.Header("ETag", "\""+hash+"\"")
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(MEDIA_CACHE_TIME)+", immutable")
+	// ServeContent handles Range and conditional requests and sniffs the type
+	http.ServeContent(c.Writer, c.Request, hash, info.ModTime(), f)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A minimal PNG header is enough for the content type detection
+var pngContent = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+func uploadTestMedia(field string, content []byte, ifMatch string) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile(field, "upload")
+	part.Write(content)
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/words/0/media", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	if ifMatch != "" {
+		c.Request.Header.Set("If-Match", ifMatch)
+	}
+	c.Params = gin.Params{{Key: "id", Value: "0"}}
+	uploadMedia(c)
+	return w
+}
+
+func TestMediaUpload(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+	gin.SetMode(gin.TestMode)
+
+	vocabulary = []Word{{ID: 0, UUID: "hund", Revision: 1, Vocabulary: "der Hund"}, {ID: 1, Vocabulary: "die Katze"}}
+	if w := uploadTestMedia("image", pngContent, ""); w.Code != http.StatusPreconditionRequired {
+		log.Printf("Upload without If-Match: expected 428 got %d", w.Code)
+		t.FailNow()
+	}
+	if w := uploadTestMedia("image", pngContent, "\"hund:0\""); w.Code != http.StatusPreconditionFailed {
+		log.Printf("Upload of stale revision: expected 412 got %d", w.Code)
+		t.FailNow()
+	}
+	w := uploadTestMedia("image", pngContent, wordETag(vocabulary[0]))
+	if w.Code != http.StatusOK {
+		log.Printf("Upload failed: %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+	var word Word
+	json.Unmarshal(w.Body.Bytes(), &word)
+	if word.Image == "" || vocabulary[0].Image != word.Image {
+		log.Printf("Image not attached: %+v", word)
+		t.FailNow()
+	}
+	if _, err := os.Stat(mediaPath(word.Image)); err != nil {
+		log.Print("Media file missing")
+		t.FailNow()
+	}
+
+	if w := uploadTestMedia("audio", pngContent, wordETag(vocabulary[0])); w.Code != http.StatusUnsupportedMediaType {
+		log.Printf("Expected unsupported media type got %d", w.Code)
+		t.FailNow()
+	}
+
+	// Media shared by another word is kept until the last word is removed
+	vocabulary[1].Image = word.Image
+	vocabulary = vocabulary[1:]
+	cleanupMedia(word.Image)
+	if _, err := os.Stat(mediaPath(word.Image)); err != nil {
+		log.Print("Shared media removed")
+		t.FailNow()
+	}
+	vocabulary = []Word{}
+	cleanupMedia(word.Image)
+	if _, err := os.Stat(mediaPath(word.Image)); !os.IsNotExist(err) {
+		log.Print("Unused media not removed")
+		t.FailNow()
+	}
+}
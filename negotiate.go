@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	JSON_CONTENT_TYPE   = "application/json"
+	YAML_CONTENT_TYPE   = "application/yaml"
+	XML_CONTENT_TYPE    = "application/xml"
+	NDJSON_CONTENT_TYPE = "application/x-ndjson"
+	XML_ROOT_ELEMENT    = "response"
+	XML_ITEM_ELEMENT    = "item"
+	XML_ENTRY_ELEMENT   = "entry"
+)
+
+// mediaTypes maps the accepted media types and their aliases to the format
+// used for responses and request bodies
+var mediaTypes = map[string]string{
+	JSON_CONTENT_TYPE:    JSON_CONTENT_TYPE,
+	"text/json":          JSON_CONTENT_TYPE,
+	YAML_CONTENT_TYPE:    YAML_CONTENT_TYPE,
+	"application/x-yaml": YAML_CONTENT_TYPE,
+	"text/yaml":          YAML_CONTENT_TYPE,
+	XML_CONTENT_TYPE:     XML_CONTENT_TYPE,
+	"text/xml":           XML_CONTENT_TYPE,
+	NDJSON_CONTENT_TYPE:  NDJSON_CONTENT_TYPE,
+	"application/ndjson": NDJSON_CONTENT_TYPE,
+	"application/jsonl":  NDJSON_CONTENT_TYPE,
+	"application/*":      JSON_CONTENT_TYPE,
+	"*/*":                JSON_CONTENT_TYPE,
+}
+
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of the Accept header ordered by their
+// quality. Ranges with the same quality keep the order of the header.
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, acceptRange{mediaType, quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+	return ranges
+}
+
+// negotiateFormat picks the response format for the Accept header. Clients
+// without a supported type get JSON, which every client understands.
+func negotiateFormat(header string) string {
+	for _, accepted := range parseAccept(header) {
+		if format, ok := mediaTypes[accepted.mediaType]; ok {
+			return format
+		}
+	}
+	return JSON_CONTENT_TYPE
+}
+
+// prettyRequested reports whether the "pretty" parameter asks for indented
+// output. The parameter without a value counts as true.
+func prettyRequested(c *gin.Context) bool {
+	value, ok := c.GetQuery("pretty")
+	if !ok {
+		return false
+	}
+	pretty, err := strconv.ParseBool(value)
+	return value == "" || (err == nil && pretty)
+}
+
+func encodeJSON(obj interface{}, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(obj, "", "    ")
+	}
+	return json.Marshal(obj)
+}
+
+// -------------------------------------------------------------------------------
+// Documents
+// -------------------------------------------------------------------------------
+
+type documentKind int
+
+const (
+	documentNull documentKind = iota
+	documentBoolean
+	documentNumber
+	documentString
+	documentArray
+	documentObject
+)
+
+var documentKinds = map[string]documentKind{
+	"null":    documentNull,
+	"boolean": documentBoolean,
+	"number":  documentNumber,
+	"string":  documentString,
+	"array":   documentArray,
+	"object":  documentObject,
+}
+
+// document is a decoded JSON value that keeps the order of the object keys,
+// so YAML and XML list the fields in the same order as JSON.
+type document struct {
+	kind  documentKind
+	value string
+	keys  []string
+	items []*document
+}
+
+func (d *document) kindName() string {
+	for name, kind := range documentKinds {
+		if kind == d.kind {
+			return name
+		}
+	}
+	return ""
+}
+
+func readDocument(decoder *json.Decoder) (*document, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case nil:
+		return &document{kind: documentNull}, nil
+	case bool:
+		return &document{kind: documentBoolean, value: strconv.FormatBool(value)}, nil
+	case json.Number:
+		return &document{kind: documentNumber, value: value.String()}, nil
+	case string:
+		return &document{kind: documentString, value: value}, nil
+	case json.Delim:
+		doc := &document{kind: documentArray}
+		if value == '{' {
+			doc.kind = documentObject
+		}
+		for decoder.More() {
+			if doc.kind == documentObject {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				doc.keys = append(doc.keys, key.(string))
+			}
+			item, err := readDocument(decoder)
+			if err != nil {
+				return nil, err
+			}
+			doc.items = append(doc.items, item)
+		}
+		// Consume the closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	return nil, errors.New("unexpected token")
+}
+
+func documentFromJSON(raw []byte) (*document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return readDocument(decoder)
+}
+
+func (d *document) writeJSON(buffer *bytes.Buffer) {
+	switch d.kind {
+	case documentNull:
+		buffer.WriteString("null")
+	case documentBoolean, documentNumber:
+		buffer.WriteString(d.value)
+	case documentString:
+		raw, _ := json.Marshal(d.value)
+		buffer.Write(raw)
+	case documentArray, documentObject:
+		open, close := byte('['), byte(']')
+		if d.kind == documentObject {
+			open, close = '{', '}'
+		}
+		buffer.WriteByte(open)
+		for idx, item := range d.items {
+			if idx > 0 {
+				buffer.WriteByte(',')
+			}
+			if d.kind == documentObject {
+				raw, _ := json.Marshal(d.keys[idx])
+				buffer.Write(raw)
+				buffer.WriteByte(':')
+			}
+			item.writeJSON(buffer)
+		}
+		buffer.WriteByte(close)
+	}
+}
+
+func (d *document) yamlNode() *yaml.Node {
+	switch d.kind {
+	case documentNull:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case documentBoolean:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: d.value}
+	case documentNumber:
+		tag := "!!int"
+		if strings.ContainsAny(d.value, ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: d.value}
+	case documentString:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.value}
+	case documentArray:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range d.items {
+			node.Content = append(node.Content, item.yamlNode())
+		}
+		return node
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for idx, item := range d.items {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.keys[idx]}
+		node.Content = append(node.Content, key, item.yamlNode())
+	}
+	return node
+}
+
+// writeXML writes the value as element. Strings and objects are written as
+// they are, every other kind is marked with a "type" attribute, so XML bodies
+// can be converted back without knowing the target type. Keys that are not
+// valid element names are written as "entry" with a "key" attribute.
+func (d *document) writeXML(encoder *xml.Encoder, name string) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlNamePattern.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		start.Name.Local = XML_ENTRY_ELEMENT
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "key"}, Value: name})
+	}
+	if d.kind != documentString && (d.kind != documentObject || len(d.items) == 0) {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: d.kindName()})
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch d.kind {
+	case documentBoolean, documentNumber, documentString:
+		if err := encoder.EncodeToken(xml.CharData(d.value)); err != nil {
+			return err
+		}
+	case documentArray:
+		for _, item := range d.items {
+			if err := item.writeXML(encoder, XML_ITEM_ELEMENT); err != nil {
+				return err
+			}
+		}
+	case documentObject:
+		for idx, item := range d.items {
+			if err := item.writeXML(encoder, d.keys[idx]); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+func xmlAttr(start xml.StartElement, name string) (string, bool) {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// readXMLElement converts the element into a document. Elements without a
+// type are objects if they contain elements and strings otherwise.
+func readXMLElement(decoder *xml.Decoder, start xml.StartElement) (*document, error) {
+	kindName, typed := xmlAttr(start, "type")
+	kind, known := documentKinds[kindName]
+	if typed && !known {
+		return nil, errors.New("unknown type " + kindName)
+	}
+	doc := &document{kind: kind}
+	text := strings.Builder{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			child, err := readXMLElement(decoder, token)
+			if err != nil {
+				return nil, err
+			}
+			key := token.Name.Local
+			if entryKey, ok := xmlAttr(token, "key"); ok && key == XML_ENTRY_ELEMENT {
+				key = entryKey
+			}
+			doc.keys = append(doc.keys, key)
+			doc.items = append(doc.items, child)
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			if !typed {
+				doc.kind = documentString
+				if len(doc.items) > 0 {
+					doc.kind = documentObject
+				}
+			}
+			switch doc.kind {
+			case documentString:
+				doc.value = text.String()
+			case documentBoolean, documentNumber:
+				doc.value = strings.TrimSpace(text.String())
+				if doc.kind == documentNumber && !json.Valid([]byte(doc.value)) {
+					return nil, errors.New("invalid number " + doc.value)
+				}
+				if _, err := strconv.ParseBool(doc.value); doc.kind == documentBoolean && err != nil {
+					return nil, errors.New("invalid boolean " + doc.value)
+				}
+			case documentArray:
+				doc.keys = nil
+			}
+			return doc, nil
+		}
+	}
+}
+
+func documentFromXML(raw []byte) (*document, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return readXMLElement(decoder, start)
+		}
+	}
+}
+
+// -------------------------------------------------------------------------------
+// Encoding
+// -------------------------------------------------------------------------------
+
+// encodeResponse converts the value into the given format. Values other than
+// lists are a single line of NDJSON.
+func encodeResponse(obj interface{}, format string, pretty bool) ([]byte, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil || format == JSON_CONTENT_TYPE || format == NDJSON_CONTENT_TYPE {
+		if pretty && err == nil && format == JSON_CONTENT_TYPE {
+			return encodeJSON(obj, true)
+		}
+		return raw, err
+	}
+	doc, err := documentFromJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	buffer := new(bytes.Buffer)
+	switch format {
+	case YAML_CONTENT_TYPE:
+		encoder := yaml.NewEncoder(buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc.yamlNode()); err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+	case XML_CONTENT_TYPE:
+		buffer.WriteString(xml.Header)
+		encoder := xml.NewEncoder(buffer)
+		if pretty {
+			encoder.Indent("", "    ")
+		}
+		if err := doc.writeXML(encoder, XML_ROOT_ELEMENT); err != nil {
+			return nil, err
+		}
+		err = encoder.Flush()
+	}
+	return buffer.Bytes(), err
+}
+
+// respond writes the value in the format the client accepts. JSON is compact
+// unless the "pretty" parameter is given.
+func respond(c *gin.Context, status int, obj interface{}) {
+	format := negotiateFormat(c.GetHeader("Accept"))
+	if value := reflect.ValueOf(obj); format == NDJSON_CONTENT_TYPE && value.Kind() == reflect.Slice {
+		respondList(c, status, value.Len(), func(idx int) interface{} {
+			return value.Index(idx).Interface()
+		})
+		return
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	raw, err := encodeResponse(obj, format, prettyRequested(c))
+	if err != nil {
+		log.Printf("Failed to encode response: %s", err)
+		respondProblem(c, http.StatusInternalServerError, ErrInternal, "failed to encode response")
+		return
+	}
+	if format == NDJSON_CONTENT_TYPE {
+		raw = append(raw, '\n')
+	}
+	c.Data(status, format+"; charset=utf-8", raw)
+}
+
+// respondList writes a list without encoding it as a whole, so the memory
+// used does not grow with the list. JSON and NDJSON are streamed entry by
+// entry, the other formats are encoded at once.
+func respondList(c *gin.Context, status int, length int, entry func(int) interface{}) {
+	format := negotiateFormat(c.GetHeader("Accept"))
+	if format != JSON_CONTENT_TYPE && format != NDJSON_CONTENT_TYPE {
+		list := make([]interface{}, length)
+		for idx := range list {
+			list[idx] = entry(idx)
+		}
+		respond(c, status, list)
+		return
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Header("Content-Type", format+"; charset=utf-8")
+	c.Status(status)
+
+	// Separators are chosen to match the output of json.MarshalIndent
+	pretty := prettyRequested(c) && format == JSON_CONTENT_TYPE
+	open, separator, close := "[", ",", "]"
+	if pretty {
+		open, separator = "[\n    ", ",\n    "
+	}
+	if format == NDJSON_CONTENT_TYPE {
+		open, separator, close = "", "", ""
+	}
+	c.Writer.WriteString(open)
+	for idx := 0; idx < length; idx++ {
+		var raw []byte
+		var err error
+		if pretty {
+			raw, err = json.MarshalIndent(entry(idx), "    ", "    ")
+		} else {
+			raw, err = json.Marshal(entry(idx))
+		}
+		if err != nil {
+			// The status is already sent, the client sees a truncated list
+			log.Printf("Failed to encode entry %d: %s", idx, err)
+			return
+		}
+		if idx > 0 {
+			c.Writer.WriteString(separator)
+		}
+		if format == NDJSON_CONTENT_TYPE {
+			raw = append(raw, '\n')
+		}
+		if _, err := c.Writer.Write(raw); err != nil {
+			log.Printf("Failed to stream response: %s", err)
+			return
+		}
+	}
+	if pretty && length > 0 {
+		close = "\n]"
+	}
+	c.Writer.WriteString(close)
+}
+
+// -------------------------------------------------------------------------------
+// Middleware
+// -------------------------------------------------------------------------------
+
+// decodeBody converts YAML and XML request bodies into JSON, so handlers and
+// the validation only deal with JSON. Other bodies are left untouched.
+func decodeBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := mediaTypes[c.ContentType()]
+		if !ok || (format != YAML_CONTENT_TYPE && format != XML_CONTENT_TYPE) {
+			c.Next()
+			return
+		}
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondBindError(c, err, "failed to read body")
+			return
+		}
+		var converted []byte
+		if format == YAML_CONTENT_TYPE {
+			var value interface{}
+			if err = yaml.Unmarshal(raw, &value); err == nil {
+				converted, err = json.Marshal(value)
+			}
+		} else {
+			var doc *document
+			if doc, err = documentFromXML(raw); err == nil {
+				buffer := new(bytes.Buffer)
+				doc.writeJSON(buffer)
+				converted = buffer.Bytes()
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to convert %s body: %s", format, err)
+			respondProblem(c, http.StatusBadRequest, ErrMalformedBody, "body is not valid "+strings.TrimPrefix(format, "application/"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(converted))
+		c.Request.ContentLength = int64(len(converted))
+		c.Request.Header.Set("Content-Type", JSON_CONTENT_TYPE)
+		c.Next()
+	}
+}
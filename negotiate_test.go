@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		format string
+	}{
+		{"", JSON_CONTENT_TYPE},
+		{"*/*", JSON_CONTENT_TYPE},
+		{"text/html", JSON_CONTENT_TYPE},
+		{"application/x-yaml", YAML_CONTENT_TYPE},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", XML_CONTENT_TYPE},
+		{"application/json;q=0.5, application/x-ndjson", NDJSON_CONTENT_TYPE},
+		{"application/yaml;q=0, application/xml;q=0.1", XML_CONTENT_TYPE},
+	}
+	for _, test := range cases {
+		if format := negotiateFormat(test.accept); format != test.format {
+			log.Printf("Accept %q: expected %s got %s", test.accept, test.format, format)
+			t.Fail()
+		}
+	}
+}
+
+// TestDocumentRoundTrip converts a word into every format and back, the
+// result has to be the same JSON.
+func TestDocumentRoundTrip(t *testing.T) {
+	word := Word{
+		Vocabulary:   "der Hund",
+		Translation:  "true",
+		Confidence:   40,
+		Tags:         []string{"animal"},
+		Translations: map[string]string{"es": "perro", "1 x": "<odd key>"},
+		Examples:     []Example{},
+	}
+	expected, _ := json.Marshal(word)
+
+	raw, err := encodeResponse(word, XML_CONTENT_TYPE, true)
+	if err != nil {
+		t.FailNow()
+	}
+	doc, err := documentFromXML(raw)
+	if err != nil {
+		log.Printf("Failed to read XML: %s\n%s", err, raw)
+		t.FailNow()
+	}
+	buffer := new(bytes.Buffer)
+	doc.writeJSON(buffer)
+	var fromXML Word
+	if err := json.Unmarshal(buffer.Bytes(), &fromXML); err != nil {
+		log.Printf("XML converted to invalid word: %s", buffer.String())
+		t.FailNow()
+	}
+	if converted, _ := json.Marshal(fromXML); !bytes.Equal(converted, expected) {
+		log.Printf("XML round trip changed the word:\n%s\n%s", converted, expected)
+		t.Fail()
+	}
+
+	raw, err = encodeResponse(word, YAML_CONTENT_TYPE, false)
+	if err != nil || !strings.HasPrefix(string(raw), "ID: 0\n") || !strings.Contains(string(raw), "Translation: \"true\"") {
+		log.Printf("Unexpected YAML: %s", raw)
+		t.Fail()
+	}
+}
+
+func TestRespondAndDecodeBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(decodeBody())
+	router.POST("/words", validateBody(wordSchema, false), func(c *gin.Context) {
+		var word Word
+		if err := c.ShouldBindJSON(&word); err != nil {
+			respondBindError(c, err, "word is in incorrect format")
+			return
+		}
+		respond(c, http.StatusCreated, []Word{word, word})
+	})
+
+	cases := []struct {
+		contentType string
+		body        string
+		accept      string
+		status      int
+		expected    string
+	}{
+		{"application/json", `{"Vocabulary": "Hund", "Translation": "dog"}`, "", http.StatusCreated, `[{"ID":0,`},
+		{"application/yaml", "Vocabulary: Hund\nTranslation: dog\nConfidence: 5\n", "application/yaml", http.StatusCreated, "- ID: 0\n"},
+		{"text/xml", `<word><Vocabulary>Hund</Vocabulary><Translation>dog</Translation><Tags type="array"><item>a</item></Tags></word>`, "application/xml", http.StatusCreated, `<?xml version="1.0" encoding="UTF-8"?>` + "\n<response type=\"array\"><item>"},
+		{"application/json", `{"Vocabulary": "Hund", "Translation": "dog"}`, "application/x-ndjson", http.StatusCreated, "{\"ID\":0,"},
+		{"application/yaml", "Vocabulary: [unclosed", "", http.StatusBadRequest, `{"type":`},
+		{"application/xml", `<word><Confidence type="number">lots</Confidence></word>`, "", http.StatusBadRequest, `{"type":`},
+		{"application/xml", `<word><Vocabulary>Hund</Vocabulary><Translation>dog</Translation><Confidence>5</Confidence></word>`, "", http.StatusUnprocessableEntity, `{"type":`},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/words", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		req.Header.Set("Accept", test.accept)
+		router.ServeHTTP(w, req)
+		if w.Code != test.status || !strings.HasPrefix(w.Body.String(), test.expected) {
+			log.Printf("%s to %s: expected %d %q got %d %s", test.contentType, test.accept, test.status, test.expected, w.Code, w.Body.String())
+			t.Fail()
+		}
+		if test.accept == NDJSON_CONTENT_TYPE && strings.Count(w.Body.String(), "\n") != 2 {
+			log.Printf("Expected one line per word: %s", w.Body.String())
+			t.Fail()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/words?pretty", strings.NewReader(`{"Vocabulary": "Hund", "Translation": "dog"}`))
+	router.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Body.String(), "[\n    {\n") {
+		log.Printf("Pretty output not indented: %s", w.Body.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MERGE_PATCH_TYPE = "application/merge-patch+json"
+	JSON_PATCH_TYPE  = "application/json-patch+json"
+)
+
+// PatchOperation is a single operation of a JSON Patch (RFC 6902)
+type PatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value json.RawMessage
+}
+
+// Words are patched in their JSON form. Object keys are matched without
+// regard to case, just like the decoding of request bodies into a Word.
+func toDocument(word Word) interface{} {
+	raw, _ := json.Marshal(word)
+	var doc interface{}
+	json.Unmarshal(raw, &doc)
+	return doc
+}
+
+func fromDocument(doc interface{}) (Word, error) {
+	var word Word
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return word, err
+	}
+	err = json.Unmarshal(raw, &word)
+	return word, err
+}
+
+func objectKey(object map[string]interface{}, key string) string {
+	if _, ok := object[key]; ok {
+		return key
+	}
+	for existing := range object {
+		if strings.EqualFold(existing, key) {
+			return existing
+		}
+	}
+	return key
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7386). Null removes a field,
+// objects are merged recursively and everything else is replaced.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		key = objectKey(targetObject, key)
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path must start with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[idx] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array position. "-" and the length are only valid as
+// the position behind the last element when adding.
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if adding && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, errors.New("invalid array index " + token)
+	}
+	if idx > length || (idx == length && !adding) {
+		return 0, errors.New("array index " + token + " out of range")
+	}
+	return idx, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[objectKey(node, token)]
+			if !ok {
+				return nil, errors.New("path " + token + " does not exist")
+			}
+			doc = value
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[idx]
+		default:
+			return nil, errors.New("path " + token + " does not exist")
+		}
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		key := objectKey(node, path[0])
+		if len(path) == 1 {
+			node[key] = value
+			return node, nil
+		}
+		child, ok := node[key]
+		if !ok {
+			return nil, errors.New("path " + path[0] + " does not exist")
+		}
+		updated, err := pointerAdd(child, path[1:], value)
+		node[key] = updated
+		return node, err
+	case []interface{}:
+		idx, err := arrayIndex(path[0], len(node), len(path) == 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		}
+		updated, err := pointerAdd(node[idx], path[1:], value)
+		node[idx] = updated
+		return node, err
+	}
+	return nil, errors.New("path " + path[0] + " does not exist")
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the whole word cannot be removed")
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		key := objectKey(node, path[0])
+		child, ok := node[key]
+		if !ok {
+			return nil, errors.New("path " + path[0] + " does not exist")
+		}
+		if len(path) == 1 {
+			delete(node, key)
+			return node, nil
+		}
+		updated, err := pointerRemove(child, path[1:])
+		node[key] = updated
+		return node, err
+	case []interface{}:
+		idx, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(node[:idx], node[idx+1:]...), nil
+		}
+		updated, err := pointerRemove(node[idx], path[1:])
+		node[idx] = updated
+		return node, err
+	}
+	return nil, errors.New("path " + path[0] + " does not exist")
+}
+
+// deepCopy is needed for "copy", otherwise both locations share their value
+func deepCopy(value interface{}) interface{} {
+	raw, _ := json.Marshal(value)
+	var copied interface{}
+	json.Unmarshal(raw, &copied)
+	return copied
+}
+
+func applyOperation(doc interface{}, operation PatchOperation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, errors.New(operation.Op + " requires a value")
+		}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch operation.Op {
+	case "add":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		return pointerRemove(doc, path)
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = pointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Op == "copy" {
+			return pointerAdd(doc, path, deepCopy(value))
+		}
+		if strings.HasPrefix(operation.Path+"/", operation.From+"/") && operation.Path != operation.From {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		if doc, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "test":
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, errors.New("test of " + operation.Path + " failed")
+		}
+		return doc, nil
+	}
+	return nil, errors.New("unknown operation " + operation.Op)
+}
+
+// jsonPatch applies all operations in order. If any of them fails the word
+// is not changed at all.
+func jsonPatch(word Word, operations []PatchOperation) (Word, error) {
+	doc := toDocument(word)
+	for _, operation := range operations {
+		var err error
+		if doc, err = applyOperation(doc, operation); err != nil {
+			return word, err
+		}
+	}
+	return fromDocument(doc)
+}
+
+func mergePatchWord(word Word, patch json.RawMessage) (Word, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		return word, err
+	}
+	if _, ok := decoded.(map[string]interface{}); !ok {
+		return word, errors.New("merge patch must be an object")
+	}
+	return fromDocument(mergePatch(toDocument(word), decoded))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergePatch(t *testing.T) {
+	word := Word{Vocabulary: "der Hund", Translation: "dog", Notes: "animal", Tags: []string{"a"}}
+	patched, err := mergePatchWord(word, json.RawMessage(`{"translation": "hound", "Notes": null, "Tags": ["b", "c"]}`))
+	if err != nil {
+		log.Printf("Failed to apply merge patch: %s", err)
+		t.FailNow()
+	}
+	if patched.Vocabulary != "der Hund" || patched.Translation != "hound" || patched.Notes != "" {
+		log.Printf("Merge patch applied incorrectly: %+v", patched)
+		t.FailNow()
+	}
+	if len(patched.Tags) != 2 || patched.Tags[0] != "b" {
+		log.Printf("Lists are not replaced: %v", patched.Tags)
+		t.FailNow()
+	}
+	if _, err := mergePatchWord(word, json.RawMessage(`["not", "an", "object"]`)); err == nil {
+		log.Print("Merge patch must be an object")
+		t.FailNow()
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	word := Word{Vocabulary: "der Hund", Translation: "dog", Tags: []string{"a", "b"}}
+	operations := []PatchOperation{
+		{Op: "test", Path: "/Vocabulary", Value: json.RawMessage(`"der Hund"`)},
+		{Op: "replace", Path: "/Translation", Value: json.RawMessage(`"hound"`)},
+		{Op: "add", Path: "/Tags/-", Value: json.RawMessage(`"c"`)},
+		{Op: "remove", Path: "/Tags/0"},
+		{Op: "copy", From: "/Translation", Path: "/Notes"},
+	}
+	patched, err := jsonPatch(word, operations)
+	if err != nil {
+		log.Printf("Failed to apply patch: %s", err)
+		t.FailNow()
+	}
+	if patched.Translation != "hound" || patched.Notes != "hound" {
+		log.Printf("Patch applied incorrectly: %+v", patched)
+		t.FailNow()
+	}
+	if len(patched.Tags) != 2 || patched.Tags[0] != "b" || patched.Tags[1] != "c" {
+		log.Printf("Array operations applied incorrectly: %v", patched.Tags)
+		t.FailNow()
+	}
+
+	// A failing operation leaves the word unchanged
+	failing := []PatchOperation{
+		{Op: "replace", Path: "/Translation", Value: json.RawMessage(`"hound"`)},
+		{Op: "test", Path: "/Vocabulary", Value: json.RawMessage(`"die Katze"`)},
+	}
+	if result, err := jsonPatch(word, failing); err == nil || result.Translation != "dog" {
+		log.Printf("Failed test did not abort the patch: %+v", result)
+		t.FailNow()
+	}
+	invalid := [][]PatchOperation{
+		{{Op: "remove", Path: "/Missing"}},
+		{{Op: "add", Path: "/Tags/5", Value: json.RawMessage(`"x"`)}},
+		{{Op: "replace", Path: "Translation", Value: json.RawMessage(`"x"`)}},
+		{{Op: "add", Path: "/Notes"}},
+		{{Op: "unknown", Path: "/Notes"}},
+	}
+	for _, operations := range invalid {
+		if _, err := jsonPatch(word, operations); err == nil {
+			log.Printf("Invalid patch accepted: %+v", operations)
+			t.Fail()
+		}
+	}
+}
+
+func patchTestWord(contentType string, etag string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PATCH", "/words/0", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	if etag != "" {
+		c.Request.Header.Set("If-Match", etag)
+	}
+	c.Params = gin.Params{{Key: "id", Value: "0"}}
+	patchDataItem(c)
+	return w
+}
+
+func TestPatchDataItem(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+	gin.SetMode(gin.TestMode)
+
+	vocabulary = []Word{{ID: 0, UUID: newUUID(), Vocabulary: "der Hund", Translation: "dog", Confidence: 40}}
+	saveVocabularyV2(&vocabulary)
+	etag := wordETag(vocabulary[0])
+
+	if w := patchTestWord(MERGE_PATCH_TYPE, "", `{"Translation": "hound"}`); w.Code != http.StatusPreconditionRequired {
+		log.Printf("Expected precondition required got %d", w.Code)
+		t.FailNow()
+	}
+	if w := patchTestWord("text/plain", etag, `{"Translation": "hound"}`); w.Code != http.StatusUnsupportedMediaType {
+		log.Printf("Expected unsupported media type got %d", w.Code)
+		t.FailNow()
+	}
+
+	w := patchTestWord(MERGE_PATCH_TYPE, etag, `{"Translation": "hound", "Confidence": 100}`)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "/words/0" {
+		log.Printf("Patch failed: %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+	var word Word
+	json.Unmarshal(w.Body.Bytes(), &word)
+	if word.Translation != "hound" || word.Confidence != 40 {
+		log.Printf("Patch applied incorrectly: %+v", word)
+		t.FailNow()
+	}
+	if w.Header().Get("ETag") == etag || w.Header().Get("ETag") != wordETag(vocabulary[0]) {
+		log.Printf("ETag not updated: %s", w.Header().Get("ETag"))
+		t.FailNow()
+	}
+	if w := patchTestWord(JSON_PATCH_TYPE, etag, `[{"op": "remove", "path": "/Notes"}]`); w.Code != http.StatusPreconditionFailed {
+		log.Printf("Stale patch accepted: %d", w.Code)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	PDF_CONTENT_TYPE       = "application/pdf"
+	DEFAULT_CARDS_PER_PAGE = 8
+	DEFAULT_PAPER          = "a4"
+	PRINT_MARGIN           = 10.0 // in mm
+	PRINT_PADDING          = 4.0  // in mm
+	PRINT_MAX_FONT_SIZE    = 28.0
+	PRINT_MIN_FONT_SIZE    = 6.0
+	PRINT_FONT_FAMILY      = "card"
+	POINT_TO_MM            = 25.4 / 72
+)
+
+// Can be changed on start, otherwise the first of the printFontCandidates
+// found is embedded
+var printFontFile = ""
+
+// printFontCandidates are common fonts with a large coverage of scripts
+var printFontCandidates = []string{
+	"/usr/share/fonts/truetype/noto/NotoSans-Regular.ttf",
+	"/usr/share/fonts/noto/NotoSans-Regular.ttf",
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/TTF/DejaVuSans.ttf",
+	"/usr/share/fonts/dejavu/DejaVuSans.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"C:\\Windows\\Fonts\\arialuni.ttf",
+	"C:\\Windows\\Fonts\\arial.ttf",
+}
+
+// cardLayouts maps the supported cards per page to columns and rows
+var cardLayouts = map[int][2]int{
+	1:  {1, 1},
+	2:  {1, 2},
+	4:  {2, 2},
+	6:  {2, 3},
+	8:  {2, 4},
+	9:  {3, 3},
+	10: {2, 5},
+	12: {3, 4},
+	16: {4, 4},
+	20: {4, 5},
+}
+
+var paperSizes = map[string]string{
+	"a4":     "A4",
+	"letter": "Letter",
+}
+
+type PrintOptions struct {
+	Paper        string
+	CardsPerPage int
+	FontFile     string // TrueType font, only Latin text is printed without one
+}
+
+func supportedCardsPerPage() string {
+	counts := []string{}
+	for _, count := range []int{1, 2, 4, 6, 8, 9, 10, 12, 16, 20} {
+		counts = append(counts, strconv.Itoa(count))
+	}
+	return strings.Join(counts, ", ")
+}
+
+func findPrintFont() string {
+	if printFontFile != "" {
+		return printFontFile
+	}
+	for _, candidate := range printFontCandidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// missingGlyphError reports text the font has no glyphs for. Printing it
+// would only show placeholders, so the cards are not printed at all.
+type missingGlyphError struct {
+	text string
+	char rune
+}
+
+func (e missingGlyphError) Error() string {
+	return fmt.Sprintf("the font cannot print %q of %q", e.char, e.text)
+}
+
+// fontCoverage returns whether the TrueType font has a glyph for a character.
+// The characters are looked up in the Unicode character map of the font.
+func fontCoverage(font []byte) (func(rune) bool, error) {
+	u16 := func(data []byte, offset int) int {
+		if offset < 0 || offset+2 > len(data) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(data[offset:]))
+	}
+	u32 := func(data []byte, offset int) int {
+		if offset < 0 || offset+4 > len(data) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint32(data[offset:]))
+	}
+	var cmap []byte
+	for idx := 0; idx < u16(font, 4); idx++ {
+		record := 12 + 16*idx
+		if record+16 <= len(font) && string(font[record:record+4]) == "cmap" {
+			start, length := u32(font, record+8), u32(font, record+12)
+			if start+length <= len(font) {
+				cmap = font[start : start+length]
+			}
+		}
+	}
+	// Prefer the full Unicode map over the one of the basic plane
+	var table []byte
+	for _, wanted := range []int{12, 4} {
+		for idx := 0; idx < u16(cmap, 2) && table == nil; idx++ {
+			platform, encoding, offset := u16(cmap, 4+8*idx), u16(cmap, 6+8*idx), u32(cmap, 8+8*idx)
+			unicodeMap := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+			if unicodeMap && offset < len(cmap) && u16(cmap, offset) == wanted {
+				table = cmap[offset:]
+			}
+		}
+	}
+	switch u16(table, 0) {
+	case 12:
+		return func(char rune) bool {
+			for group := 0; group < u32(table, 12); group++ {
+				start, end := u32(table, 16+12*group), u32(table, 20+12*group)
+				if int(char) >= start && int(char) <= end {
+					return u32(table, 24+12*group)+int(char)-start != 0
+				}
+			}
+			return false
+		}, nil
+	case 4:
+		segments := u16(table, 6) / 2
+		return func(char rune) bool {
+			for segment := 0; segment < segments; segment++ {
+				end, start := u16(table, 14+2*segment), u16(table, 16+2*segments+2*segment)
+				if int(char) > end || int(char) < start {
+					continue
+				}
+				delta := u16(table, 16+4*segments+2*segment)
+				rangeOffset := 16 + 6*segments + 2*segment
+				if u16(table, rangeOffset) == 0 {
+					return (int(char)+delta)&0xFFFF != 0
+				}
+				glyph := u16(table, rangeOffset+u16(table, rangeOffset)+2*(int(char)-start))
+				return glyph != 0 && (glyph+delta)&0xFFFF != 0
+			}
+			return false
+		}, nil
+	}
+	return nil, errors.New("font has no Unicode character map")
+}
+
+// latinCoverage is the coverage of the core fonts without an embedded font
+func latinCoverage(char rune) bool {
+	_, ok := charmap.Windows1252.EncodeRune(char)
+	return ok
+}
+
+// checkGlyphs returns an error for the first text with a character that
+// cannot be printed.
+func checkGlyphs(words []Word, covered func(rune) bool) error {
+	for _, word := range words {
+		for _, text := range []string{word.Vocabulary, word.Translation} {
+			for _, char := range text {
+				if !unicode.IsSpace(char) && !covered(char) {
+					return missingGlyphError{text, char}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cardPrinter writes text into the cells of the card grid. Without an
+// embedded font the text is converted to the code page of the core fonts.
+type cardPrinter struct {
+	pdf       *gofpdf.Fpdf
+	translate func(string) string
+}
+
+func (p cardPrinter) split(text string, width float64) []string {
+	if p.translate == nil {
+		return p.pdf.SplitText(text, width)
+	}
+	lines := []string{}
+	for _, line := range p.pdf.SplitLines([]byte(p.translate(text)), width) {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// fit returns the lines of the text at the largest font size that still fits
+// into the cell.
+func (p cardPrinter) fit(text string, width float64, height float64) ([]string, float64) {
+	size := PRINT_MAX_FONT_SIZE
+	for {
+		p.pdf.SetFontSize(size)
+		lines := p.split(text, width)
+		lineHeight := size * POINT_TO_MM * 1.25
+		if float64(len(lines))*lineHeight <= height || size <= PRINT_MIN_FONT_SIZE {
+			return lines, lineHeight
+		}
+		size -= 1
+	}
+}
+
+func (p cardPrinter) card(text string, x float64, y float64, width float64, height float64) {
+	p.pdf.SetDrawColor(180, 180, 180)
+	p.pdf.SetDashPattern([]float64{1, 1}, 0)
+	p.pdf.Rect(x, y, width, height, "D")
+
+	inner := width - 2*PRINT_PADDING
+	lines, lineHeight := p.fit(text, inner, height-2*PRINT_PADDING)
+	top := y + (height-float64(len(lines))*lineHeight)/2
+	for idx, line := range lines {
+		p.pdf.SetXY(x+PRINT_PADDING, top+float64(idx)*lineHeight)
+		p.pdf.CellFormat(inner, lineHeight, line, "", 0, "C", false, 0, "")
+	}
+}
+
+// renderFlashcards lays out the words as double-sided cards. Every page of
+// fronts is followed by a page of backs with the columns mirrored, so the
+// sides match when printing duplex and flipping on the long edge.
+func renderFlashcards(w io.Writer, words []Word, title string, options PrintOptions) error {
+	layout := cardLayouts[options.CardsPerPage]
+	columns, rows := layout[0], layout[1]
+	pdf := gofpdf.New("P", "mm", paperSizes[options.Paper], "")
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("Vocabulary", true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetMargins(PRINT_MARGIN, PRINT_MARGIN, PRINT_MARGIN)
+
+	printer := cardPrinter{pdf: pdf}
+	if options.FontFile != "" {
+		font, err := os.ReadFile(options.FontFile)
+		if err != nil {
+			return err
+		}
+		covered, err := fontCoverage(font)
+		if err != nil {
+			return err
+		}
+		if err := checkGlyphs(words, covered); err != nil {
+			return err
+		}
+		pdf.AddUTF8FontFromBytes(PRINT_FONT_FAMILY, "", font)
+		pdf.SetFont(PRINT_FONT_FAMILY, "", PRINT_MAX_FONT_SIZE)
+	} else {
+		if err := checkGlyphs(words, latinCoverage); err != nil {
+			return err
+		}
+		log.Print("No font found, printing Latin characters only")
+		pdf.SetFont("Helvetica", "", PRINT_MAX_FONT_SIZE)
+		printer.translate = pdf.UnicodeTranslatorFromDescriptor("")
+	}
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	width := (pageWidth - 2*PRINT_MARGIN) / float64(columns)
+	height := (pageHeight - 2*PRINT_MARGIN) / float64(rows)
+	for start := 0; start < len(words); start += options.CardsPerPage {
+		end := start + options.CardsPerPage
+		if end > len(words) {
+			end = len(words)
+		}
+		page := words[start:end]
+		pdf.AddPage()
+		for idx, word := range page {
+			column, row := idx%columns, idx/columns
+			printer.card(word.Vocabulary, PRINT_MARGIN+float64(column)*width, PRINT_MARGIN+float64(row)*height, width, height)
+		}
+		pdf.AddPage()
+		for idx, word := range page {
+			column, row := columns-1-idx%columns, idx/columns
+			printer.card(word.Translation, PRINT_MARGIN+float64(column)*width, PRINT_MARGIN+float64(row)*height, width, height)
+		}
+	}
+	return pdf.Output(w)
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+// printDeck returns the words of the deck as printable flashcards. The
+// parameters "paper" (a4 or letter) and "cards" (cards per page) control the
+// layout.
+func printDeck(c *gin.Context) {
+	compare, _ := strconv.Atoi(c.Param("id"))
+	idx, ok := findDeck(compare)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, ErrDeckNotFound, "deck not found")
+		return
+	}
+	options := PrintOptions{Paper: strings.ToLower(c.DefaultQuery("paper", DEFAULT_PAPER)), FontFile: findPrintFont()}
+	if _, ok := paperSizes[options.Paper]; !ok {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "paper must be either a4 or letter")
+		return
+	}
+	options.CardsPerPage, _ = strconv.Atoi(c.DefaultQuery("cards", strconv.Itoa(DEFAULT_CARDS_PER_PAGE)))
+	if _, ok := cardLayouts[options.CardsPerPage]; !ok {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "cards must be one of "+supportedCardsPerPage())
+		return
+	}
+	words := wordsInDeck(vocabulary, decks[idx].ID)
+	if len(words) == 0 {
+		respondProblem(c, http.StatusConflict, ErrVocabularyEmpty, "deck is empty")
+		return
+	}
+
+	buffer := new(bytes.Buffer)
+	var missing missingGlyphError
+	if err := renderFlashcards(buffer, words, decks[idx].Name, options); errors.As(err, &missing) {
+		respondProblem(c, http.StatusUnprocessableEntity, ErrMissingGlyphs, missing.Error()+", configure a font covering it with -font")
+		return
+	} else if err != nil {
+		log.Printf("Failed to render flashcards: %s", err)
+		respondProblem(c, http.StatusInternalServerError, ErrInternal, "failed to render flashcards")
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=\"deck-"+strconv.Itoa(decks[idx].ID)+".pdf\"")
+	c.Data(http.StatusOK, PDF_CONTENT_TYPE, buffer.Bytes())
+}
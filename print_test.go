@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var pdfPagePattern = regexp.MustCompile(`/Type /Page\b[^s]`)
+
+func TestRenderFlashcards(t *testing.T) {
+	words := []Word{
+		{Vocabulary: "der Hund", Translation: "dog"},
+		{Vocabulary: "le chien", Translation: "dog in French"},
+		{Vocabulary: "el perro", Translation: "a rather long translation that certainly needs to be wrapped onto several lines of the card"},
+	}
+	fonts := []string{""}
+	if font := findPrintFont(); font != "" {
+		fonts = append(fonts, font)
+	}
+	for _, font := range fonts {
+		buffer := new(bytes.Buffer)
+		if err := renderFlashcards(buffer, words, "Animals", PrintOptions{Paper: "letter", CardsPerPage: 2, FontFile: font}); err != nil {
+			log.Printf("Failed to render with font %q: %s", font, err)
+			t.FailNow()
+		}
+		if !bytes.HasPrefix(buffer.Bytes(), []byte("%PDF")) {
+			log.Print("Output is not a PDF")
+			t.Fail()
+		}
+		// Two pages of fronts, each followed by its backs
+		if pages := len(pdfPagePattern.FindAll(buffer.Bytes(), -1)); pages != 4 {
+			log.Printf("Expected 4 pages got %d", pages)
+			t.Fail()
+		}
+	}
+
+	// Without a font only Latin text is printed instead of placeholders
+	var missing missingGlyphError
+	err := renderFlashcards(new(bytes.Buffer), []Word{{Vocabulary: "собака", Translation: "dog"}}, "Animals", PrintOptions{Paper: "a4", CardsPerPage: 2})
+	if !errors.As(err, &missing) || missing.char != 'с' {
+		log.Printf("Missing glyph not reported: %v", err)
+		t.Fail()
+	}
+}
+
+func TestFontCoverage(t *testing.T) {
+	font := findPrintFont()
+	if font == "" {
+		t.Skip("no font installed")
+	}
+	content, err := os.ReadFile(font)
+	if err != nil {
+		t.FailNow()
+	}
+	covered, err := fontCoverage(content)
+	if err != nil {
+		log.Printf("Failed to read the character map: %s", err)
+		t.FailNow()
+	}
+	for _, char := range "Hundäßсобака" {
+		if !covered(char) {
+			log.Printf("Glyph of %q missing", char)
+			t.Fail()
+		}
+	}
+	// Unassigned characters have no glyph in any font
+	if covered('\u0378') || covered('\U0010FFFF') {
+		log.Print("Glyph of unassigned character found")
+		t.Fail()
+	}
+	if _, err := fontCoverage([]byte("no font")); err == nil {
+		t.Fail()
+	}
+}
+
+func TestPrintDeck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/decks/:id/print.pdf", printDeck)
+	decks = []Deck{{ID: 1, Name: "Animals"}, {ID: 2, Name: "Empty"}, {ID: 3, Name: "Unprintable"}}
+	vocabulary = []Word{{Vocabulary: "der Hund", Translation: "dog", Deck: 1}, {Vocabulary: "\u0378", Translation: "unassigned", Deck: 3}}
+
+	cases := []struct {
+		path   string
+		status int
+	}{
+		{"/decks/1/print.pdf", http.StatusOK},
+		{"/decks/1/print.pdf?paper=letter&cards=12", http.StatusOK},
+		{"/decks/1/print.pdf?paper=a3", http.StatusBadRequest},
+		{"/decks/1/print.pdf?cards=7", http.StatusBadRequest},
+		{"/decks/2/print.pdf", http.StatusConflict},
+		{"/decks/3/print.pdf", http.StatusUnprocessableEntity},
+		{"/decks/4/print.pdf", http.StatusNotFound},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			log.Printf("%s: expected %d got %d", test.path, test.status, w.Code)
+			t.Fail()
+		}
+	}
+}
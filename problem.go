@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PROBLEM_CONTENT_TYPE = "application/problem+json"
+	PROBLEM_TYPE_PREFIX  = "urn:vocabulary:problem:"
+	REQUEST_ID_HEADER    = "X-Request-ID"
+)
+
+// ErrorCode identifies the kind of an error. Clients should rely on the code
+// instead of the human readable detail, the codes never change.
+type ErrorCode string
+
+const (
+	ErrMalformedBody        ErrorCode = "malformed_body"
+	ErrInvalidParameter     ErrorCode = "invalid_parameter"
+	ErrInvalidRequest       ErrorCode = "invalid_request"
+	ErrValidationFailed     ErrorCode = "validation_failed"
+	ErrUnauthorized         ErrorCode = "unauthorized"
+	ErrInvalidToken         ErrorCode = "invalid_token"
+	ErrForbidden            ErrorCode = "forbidden"
+	ErrRouteNotFound        ErrorCode = "route_not_found"
+	ErrMethodNotAllowed     ErrorCode = "method_not_allowed"
+	ErrWordNotFound         ErrorCode = "word_not_found"
+	ErrDeckNotFound         ErrorCode = "deck_not_found"
+	ErrQuizNotFound         ErrorCode = "quiz_not_found"
+	ErrQuestionNotFound     ErrorCode = "question_not_found"
+	ErrMediaNotFound        ErrorCode = "media_not_found"
+	ErrWordExists           ErrorCode = "word_exists"
+	ErrWordRemoved          ErrorCode = "word_removed"
+	ErrAlreadyAnswered      ErrorCode = "already_answered"
+	ErrVocabularyEmpty      ErrorCode = "vocabulary_empty"
+	ErrPreconditionRequired ErrorCode = "precondition_required"
+	ErrPreconditionFailed   ErrorCode = "precondition_failed"
+	ErrUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	ErrPayloadTooLarge      ErrorCode = "payload_too_large"
+	ErrPatchFailed          ErrorCode = "patch_failed"
+	ErrEditConflict         ErrorCode = "edit_conflict"
+	ErrSyncTokenExpired     ErrorCode = "sync_token_expired"
+	ErrMissingGlyphs        ErrorCode = "missing_glyphs"
+	ErrInternal             ErrorCode = "internal_error"
+)
+
+// FieldError describes a single invalid field of a request body. The field
+// is given as JSON Pointer, e.g. "/Examples/0/Sentence".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is the body of every error response (RFC 7807). The member names
+// are fixed by the RFC, therefore this type uses lower case JSON names.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extension member of conflicts with an existing word
+	Existing *Word `json:"existing,omitempty"`
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newProblem(status int, code ErrorCode, detail string) *Problem {
+	return &Problem{
+		Type:   PROBLEM_TYPE_PREFIX + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString("requestId")
+}
+
+// writeProblem sends the problem and stops all further handlers, so it can be
+// used by handlers and middleware alike.
+func writeProblem(c *gin.Context, problem *Problem) {
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = requestID(c)
+	log.Printf("Request %s failed with %d %s: %s", problem.RequestID, problem.Status, problem.Code, problem.Detail)
+	c.Abort()
+	raw, err := encodeJSON(problem, prettyRequested(c))
+	if err != nil {
+		log.Printf("Failed to encode problem: %s", err)
+	}
+	c.Data(problem.Status, PROBLEM_CONTENT_TYPE, raw)
+}
+
+func respondProblem(c *gin.Context, status int, code ErrorCode, detail string) {
+	writeProblem(c, newProblem(status, code, detail))
+}
+
+// respondBindError distinguishes bodies exceeding the size limit from bodies
+// that could not be decoded.
+func respondBindError(c *gin.Context, err error, detail string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondProblem(c, http.StatusRequestEntityTooLarge, ErrPayloadTooLarge, "request body too large")
+		return
+	}
+	respondProblem(c, http.StatusBadRequest, ErrMalformedBody, detail)
+}
+
+func respondValidationProblem(c *gin.Context, fields []FieldError) {
+	problem := newProblem(http.StatusUnprocessableEntity, ErrValidationFailed, fields[0].Message)
+	problem.Errors = fields
+	writeProblem(c, problem)
+}
+
+// -------------------------------------------------------------------------------
+// Middleware
+// -------------------------------------------------------------------------------
+
+// requestIDMiddleware tags every request with an ID, which is returned in the
+// response and in errors. IDs given by the client are kept so requests can be
+// traced across services.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(REQUEST_ID_HEADER)
+		if !requestIDPattern.MatchString(id) {
+			id = newUUID()
+		}
+		c.Set("requestId", id)
+		c.Header(REQUEST_ID_HEADER, id)
+		c.Next()
+	}
+}
+
+func recoverWithProblem(c *gin.Context, err interface{}) {
+	log.Printf("Request %s panicked: %v", requestID(c), err)
+	respondProblem(c, http.StatusInternalServerError, ErrInternal, "internal server error")
+}
+
+func routeNotFound(c *gin.Context) {
+	respondProblem(c, http.StatusNotFound, ErrRouteNotFound, "route not found")
+}
+
+func methodNotAllowed(c *gin.Context) {
+	respondProblem(c, http.StatusMethodNotAllowed, ErrMethodNotAllowed, "method not allowed")
+}
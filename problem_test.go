@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func problemTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(routeNotFound)
+	router.NoMethod(methodNotAllowed)
+	router.Use(requestIDMiddleware(), gin.CustomRecovery(recoverWithProblem))
+	router.GET("/words/:id", getDataItem)
+	router.POST("/words", postData)
+	router.GET("/panic", func(c *gin.Context) {
+		panic("test")
+	})
+	router.GET("/secret", authenticationMiddleware(), getDataItem)
+	return router
+}
+
+func requestProblem(router *gin.Engine, method string, path string, id string) (*httptest.ResponseRecorder, Problem) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if id != "" {
+		req.Header.Set(REQUEST_ID_HEADER, id)
+	}
+	router.ServeHTTP(w, req)
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	return w, problem
+}
+
+func TestProblemResponses(t *testing.T) {
+	router := problemTestRouter()
+	vocabulary = []Word{}
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		code   ErrorCode
+	}{
+		{"GET", "/words/7", http.StatusNotFound, ErrWordNotFound},
+		{"GET", "/unknown", http.StatusNotFound, ErrRouteNotFound},
+		{"DELETE", "/panic", http.StatusMethodNotAllowed, ErrMethodNotAllowed},
+		{"GET", "/panic", http.StatusInternalServerError, ErrInternal},
+		{"GET", "/secret", http.StatusUnauthorized, ErrUnauthorized},
+	}
+	for _, test := range cases {
+		w, problem := requestProblem(router, test.method, test.path, "")
+		if w.Code != test.status || problem.Status != test.status || problem.Code != test.code {
+			log.Printf("%s %s: expected %d %s got %d %s", test.method, test.path, test.status, test.code, w.Code, w.Body.String())
+			t.Fail()
+			continue
+		}
+		if w.Header().Get("Content-Type") != PROBLEM_CONTENT_TYPE || problem.Type != PROBLEM_TYPE_PREFIX+string(test.code) {
+			log.Printf("%s %s: not a problem response: %s", test.method, test.path, w.Header().Get("Content-Type"))
+			t.Fail()
+		}
+		if problem.Instance != test.path || problem.RequestID == "" || problem.RequestID != w.Header().Get(REQUEST_ID_HEADER) {
+			log.Printf("%s %s: missing instance or request id: %+v", test.method, test.path, problem)
+			t.Fail()
+		}
+	}
+
+	// Valid request IDs of the client are kept, invalid ones replaced
+	if _, problem := requestProblem(router, "GET", "/words/7", "client-42"); problem.RequestID != "client-42" {
+		log.Printf("Client request id not kept: %s", problem.RequestID)
+		t.Fail()
+	}
+	if _, problem := requestProblem(router, "GET", "/words/7", "bad id\n"); problem.RequestID == "bad id\n" {
+		log.Print("Invalid request id accepted")
+		t.Fail()
+	}
+}
+
+func TestDuplicateProblem(t *testing.T) {
+	router := problemTestRouter()
+	vocabulary = []Word{{UUID: "hund", Vocabulary: "der Hund", Translation: "dog"}}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/words", strings.NewReader(`{"Vocabulary": "der Hund", "Translation": "dog"}`))
+	router.ServeHTTP(w, req)
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	if w.Code != http.StatusConflict || problem.Existing == nil || problem.Existing.UUID != "hund" {
+		log.Printf("Existing word missing in conflict: %d %s", w.Code, w.Body.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+const MAX_PAGE_SIZE = 1000
+
+type SortKey string
+
+const (
+	SortNone       SortKey = ""
+	SortAlpha      SortKey = "alpha"
+	SortConfidence SortKey = "confidence"
+	SortRecent     SortKey = "recent"
+)
+
+// WordFilter restricts the words returned or changed by a request. Tags are
+// combined with AND unless MatchAny is set. A negative Deck matches all decks.
+// From and To select words by their source language and a translation into
+// the target language. Zero times and nil confidences are not checked.
+type WordFilter struct {
+	Tags          []string
+	MatchAny      bool
+	Deck          int
+	From          string
+	To            string
+	MinConfidence *int
+	MaxConfidence *int
+	DueBefore     time.Time
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// WordPage selects the part of the filtered and sorted words to return.
+type WordPage struct {
+	Sort   SortKey
+	Locale string
+	Limit  int // 0 returns all words
+	After  string
+	Offset int
+}
+
+// pageCursor is handed to clients base64 encoded. It points behind the last
+// returned word; the offset is only used if this word was removed meanwhile.
+type pageCursor struct {
+	Sort   SortKey
+	After  string
+	Offset int
+}
+
+func (f WordFilter) matches(word Word) bool {
+	if f.Deck >= 0 && word.Deck != f.Deck {
+		return false
+	}
+	if source, _ := wordLanguages(word); f.From != "" && source != f.From {
+		return false
+	}
+	if _, ok := translationInto(word, f.To); f.To != "" && !ok {
+		return false
+	}
+	if f.MinConfidence != nil && word.Confidence < *f.MinConfidence {
+		return false
+	}
+	if f.MaxConfidence != nil && word.Confidence > *f.MaxConfidence {
+		return false
+	}
+	if !f.DueBefore.IsZero() && !word.Schedule.Due.Before(f.DueBefore) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !word.Created.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !word.Created.Before(f.CreatedBefore) {
+		return false
+	}
+	if len(f.Tags) == 0 {
+		return true
+	}
+	for _, tag := range f.Tags {
+		found := hasTag(word, tag)
+		if f.MatchAny && found {
+			return true
+		}
+		if !f.MatchAny && !found {
+			return false
+		}
+	}
+	return !f.MatchAny
+}
+
+// filterWords returns the indices of all words matching the filter.
+func filterWords(words []Word, filter WordFilter) []int {
+	matching := []int{}
+	for idx, word := range words {
+		if filter.matches(word) {
+			matching = append(matching, idx)
+		}
+	}
+	return matching
+}
+
+func parseOptionalInt(c *gin.Context, key string) (*int, bool) {
+	param, ok := c.GetQuery(key)
+	if !ok {
+		return nil, true
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil {
+		return nil, false
+	}
+	return &value, true
+}
+
+// parseOptionalTime accepts either a full RFC 3339 timestamp or a date.
+func parseOptionalTime(c *gin.Context, key string) (time.Time, bool) {
+	param, ok := c.GetQuery(key)
+	if !ok {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, param); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", param, time.Local)
+	return t, err == nil
+}
+
+// parseWordFilter reads the filter from the query parameters "tag" (repeated
+// or comma separated), "match" (all or any), "deck", "from", "to",
+// "minConfidence", "maxConfidence", "dueBefore", "createdAfter" and
+// "createdBefore".
+func parseWordFilter(c *gin.Context) (WordFilter, string) {
+	filter := WordFilter{}
+	tags := []string{}
+	for _, param := range c.QueryArray("tag") {
+		tags = append(tags, strings.Split(param, ",")...)
+	}
+	filter.Tags = normalizeTags(tags)
+	switch c.DefaultQuery("match", "all") {
+	case "all":
+	case "any":
+		filter.MatchAny = true
+	default:
+		return filter, "match must be either all or any"
+	}
+	deck, ok := deckFilter(c)
+	if !ok {
+		return filter, "given deck does not exist"
+	}
+	filter.Deck = deck
+	filter.From = normalizeLanguage(c.Query("from"))
+	filter.To = normalizeLanguage(c.Query("to"))
+	if !validLanguage(filter.From) || !validLanguage(filter.To) {
+		return filter, "invalid language code"
+	}
+	var minOk, maxOk bool
+	filter.MinConfidence, minOk = parseOptionalInt(c, "minConfidence")
+	filter.MaxConfidence, maxOk = parseOptionalInt(c, "maxConfidence")
+	if !minOk || !maxOk {
+		return filter, "invalid confidence range"
+	}
+	var dueOk, afterOk, beforeOk bool
+	filter.DueBefore, dueOk = parseOptionalTime(c, "dueBefore")
+	filter.CreatedAfter, afterOk = parseOptionalTime(c, "createdAfter")
+	filter.CreatedBefore, beforeOk = parseOptionalTime(c, "createdBefore")
+	if !dueOk || !afterOk || !beforeOk {
+		return filter, "invalid date"
+	}
+	return filter, ""
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded string) (pageCursor, bool) {
+	var cursor pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, false
+	}
+	return cursor, json.Unmarshal(raw, &cursor) == nil
+}
+
+// parseWordPage reads the query parameters "sort", "locale", "limit" and
+// "cursor". A cursor can only be used with the sort order it was created for.
+func parseWordPage(c *gin.Context, filter WordFilter) (WordPage, string) {
+	page := WordPage{Sort: SortKey(c.Query("sort")), Locale: c.Query("locale")}
+	switch page.Sort {
+	case SortNone, SortAlpha, SortConfidence, SortRecent:
+	default:
+		return page, "unknown sort key"
+	}
+	if page.Locale == "" {
+		page.Locale = filter.From
+	}
+	if _, err := language.Parse(page.Locale); page.Locale != "" && err != nil {
+		return page, "invalid locale"
+	}
+	if param, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > MAX_PAGE_SIZE {
+			return page, "limit out of range"
+		}
+		page.Limit = limit
+	}
+	if param, ok := c.GetQuery("cursor"); ok {
+		cursor, ok := decodeCursor(param)
+		if !ok || cursor.Sort != page.Sort || cursor.Offset < 0 {
+			return page, "invalid cursor"
+		}
+		page.After = cursor.After
+		page.Offset = cursor.Offset
+	}
+	return page, ""
+}
+
+// sortWords orders the word indices by the given key. Ties are broken by the
+// position in the vocabulary so that pages are stable between requests.
+func sortWords(words []Word, indices []int, key SortKey, locale string) {
+	switch key {
+	case SortAlpha:
+		tag := language.Und
+		if locale != "" {
+			tag = language.Make(locale)
+		}
+		collator := collate.New(tag, collate.IgnoreCase)
+		sort.SliceStable(indices, func(i, j int) bool {
+			return collator.CompareString(words[indices[i]].Vocabulary, words[indices[j]].Vocabulary) < 0
+		})
+	case SortConfidence:
+		sort.SliceStable(indices, func(i, j int) bool {
+			return words[indices[i]].Confidence < words[indices[j]].Confidence
+		})
+	case SortRecent:
+		// Words created before the creation time was stored have a zero
+		// time and are ordered by their position instead
+		sort.SliceStable(indices, func(i, j int) bool {
+			a, b := words[indices[i]], words[indices[j]]
+			if !a.Created.Equal(b.Created) {
+				return a.Created.After(b.Created)
+			}
+			return indices[i] > indices[j]
+		})
+	}
+}
+
+// paginate returns the indices of the requested page and the cursor for the
+// next page, which is empty if there are no more words.
+func paginate(words []Word, indices []int, page WordPage) ([]int, string) {
+	start := 0
+	if page.After != "" {
+		start = page.Offset
+		for pos, idx := range indices {
+			if words[idx].UUID == page.After {
+				start = pos + 1
+				break
+			}
+		}
+	}
+	if start < 0 {
+		start = 0
+	} else if start > len(indices) {
+		start = len(indices)
+	}
+	end := len(indices)
+	if page.Limit > 0 && start+page.Limit < end {
+		end = start + page.Limit
+	}
+	next := ""
+	if end < len(indices) {
+		next = encodeCursor(pageCursor{Sort: page.Sort, After: words[indices[end-1]].UUID, Offset: end})
+	}
+	return indices[start:end], next
+}
+
+func nextPageLink(c *gin.Context, cursor string) string {
+	next := url.URL{Path: c.Request.URL.Path}
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	return "<" + next.String() + ">; rel=\"next\""
+}
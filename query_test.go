@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var queryWords = []Word{
+	{UUID: "0", Vocabulary: "Zug", Confidence: 80},
+	{UUID: "1", Vocabulary: "Äpfel", Confidence: 10, Created: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	{UUID: "2", Vocabulary: "apfel", Confidence: 50, Created: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	{UUID: "3", Vocabulary: "Birne", Confidence: 50, Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{UUID: "4", Vocabulary: "Banane", Confidence: 30},
+}
+
+func sortedIndices(key SortKey, locale string) []int {
+	indices := []int{0, 1, 2, 3, 4}
+	sortWords(queryWords, indices, key, locale)
+	return indices
+}
+
+func TestSortWords(t *testing.T) {
+	expected := map[SortKey][]int{
+		SortNone:       {0, 1, 2, 3, 4},
+		SortAlpha:      {2, 1, 4, 3, 0},
+		SortConfidence: {1, 4, 2, 3, 0},
+		SortRecent:     {2, 1, 3, 4, 0},
+	}
+	for key, order := range expected {
+		if result := sortedIndices(key, "de"); !reflect.DeepEqual(result, order) {
+			log.Printf("Sort %q: expected %v got %v", key, order, result)
+			t.Fail()
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	indices := sortedIndices(SortConfidence, "")
+	page := WordPage{Sort: SortConfidence, Limit: 2}
+	first, next := paginate(queryWords, indices, page)
+	if !reflect.DeepEqual(first, []int{1, 4}) || next == "" {
+		log.Printf("Unexpected first page %v", first)
+		t.FailNow()
+	}
+
+	cursor, ok := decodeCursor(next)
+	if !ok || cursor.After != "4" {
+		log.Printf("Invalid cursor %q", next)
+		t.FailNow()
+	}
+	page.After, page.Offset = cursor.After, cursor.Offset
+	second, next := paginate(queryWords, indices, page)
+	if !reflect.DeepEqual(second, []int{2, 3}) || next == "" {
+		log.Printf("Unexpected second page %v", second)
+		t.FailNow()
+	}
+
+	cursor, _ = decodeCursor(next)
+	page.After, page.Offset = cursor.After, cursor.Offset
+	last, next := paginate(queryWords, indices, page)
+	if !reflect.DeepEqual(last, []int{0}) || next != "" {
+		log.Printf("Unexpected last page %v %q", last, next)
+		t.FailNow()
+	}
+
+	// The offset of a crafted cursor must stay within the words
+	for _, offset := range []int{-5, 99} {
+		page.After, page.Offset = "unknown", offset
+		if result, _ := paginate(queryWords, indices, page); len(result) > 2 {
+			t.Fail()
+		}
+	}
+}
+
+func TestFilterConfidenceAndDates(t *testing.T) {
+	low, high := 30, 50
+	filter := WordFilter{Deck: -1, MinConfidence: &low, MaxConfidence: &high, CreatedAfter: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}
+	if result := filterWords(queryWords, filter); !reflect.DeepEqual(result, []int{2}) {
+		log.Printf("Unexpected filter result %v", result)
+		t.FailNow()
+	}
+}
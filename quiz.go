@@ -0,0 +1,328 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULT_QUIZ_QUESTIONS = 10
+	MAX_QUIZ_QUESTIONS     = 100
+	DEFAULT_QUIZ_CHOICES   = 4
+	MAX_QUIZ_CHOICES       = 10
+	QUIZ_SESSION_LIFETIME  = 24 * time.Hour
+)
+
+type QuestionType string
+
+const (
+	QuestionMultipleChoice QuestionType = "choice"
+	QuestionTyped          QuestionType = "typed"
+)
+
+func (q QuestionType) valid() bool {
+	return q == QuestionMultipleChoice || q == QuestionTyped
+}
+
+type QuizRequest struct {
+	Questions int
+	Direction Direction
+	Types     []QuestionType
+	Choices   int
+}
+
+type QuizQuestion struct {
+	Index    int
+	WordID   int
+	Type     QuestionType
+	Prompt   string
+	Choices  []string
+	Answered bool
+	Result   AnswerResult
+	answer   string
+	wordUUID string
+}
+
+type QuizSession struct {
+	ID        string
+	User      string
+	Direction Direction
+	Created   time.Time
+	Questions []QuizQuestion
+}
+
+type QuizAnswer struct {
+	Index        int
+	Answer       string
+	ResponseTime int
+}
+
+type QuizAnswerResult struct {
+	Index    int
+	Result   AnswerResult
+	Grade    Grade
+	Expected string
+	Word     Word
+}
+
+var quizSessions = map[string]*QuizSession{}
+
+// quizLock guards the sessions and their questions, since gin runs handlers
+// concurrently
+var quizLock sync.Mutex
+
+func promptAndAnswer(word Word, direction Direction) (string, string) {
+	if direction == DirectionReverse {
+		return word.Translation, word.Vocabulary
+	}
+	return word.Vocabulary, word.Translation
+}
+
+// selectQuizWords picks the words to ask for. Words which are due (or were
+// never reviewed) come first, the remaining slots are filled randomly.
+func selectQuizWords(words []Word, count int, now time.Time, rnd *rand.Rand) []int {
+	due := []int{}
+	rest := []int{}
+	for _, idx := range rnd.Perm(len(words)) {
+		if words[idx].Schedule.Due.Before(now) {
+			due = append(due, idx)
+		} else {
+			rest = append(rest, idx)
+		}
+	}
+	selected := append(due, rest...)
+	if count > len(selected) {
+		count = len(selected)
+	}
+	return selected[:count]
+}
+
+// distractorScore rates how plausible an answer is as a wrong choice. Answers
+// with a similar length and the same beginning as the correct one score lower.
+func distractorScore(correct string, candidate string) int {
+	a := []rune(strings.ToLower(correct))
+	b := []rune(strings.ToLower(candidate))
+	score := len(a) - len(b)
+	if score < 0 {
+		score = -score
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix += 1
+	}
+	return score - 2*prefix
+}
+
+// selectDistractors chooses wrong answers from the given vocabulary. To keep
+// quizzes varied the choices are drawn randomly from the most plausible ones.
+func selectDistractors(words []Word, correct string, direction Direction, count int, rnd *rand.Rand) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(correct)): true}
+	candidates := []string{}
+	for _, word := range words {
+		_, answer := promptAndAnswer(word, direction)
+		key := strings.ToLower(strings.TrimSpace(answer))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, answer)
+	}
+	rnd.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return distractorScore(correct, candidates[i]) < distractorScore(correct, candidates[j])
+	})
+	if count > MAX_QUIZ_CHOICES {
+		count = MAX_QUIZ_CHOICES
+	}
+	pool := candidates
+	if len(pool) > 2*count {
+		pool = pool[:2*count]
+	}
+	rnd.Shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+	if len(pool) > count {
+		pool = pool[:count]
+	}
+	return pool
+}
+
+func buildQuiz(words []Word, request QuizRequest, user string, now time.Time, rnd *rand.Rand) *QuizSession {
+	session := &QuizSession{
+		ID:        newUUID(),
+		User:      user,
+		Direction: request.Direction,
+		Created:   now,
+		Questions: []QuizQuestion{},
+	}
+	for idx, wordIdx := range selectQuizWords(words, request.Questions, now, rnd) {
+		word := words[wordIdx]
+		prompt, answer := promptAndAnswer(word, request.Direction)
+		question := QuizQuestion{
+			Index:    idx,
+			WordID:   word.ID,
+			Type:     request.Types[rnd.Intn(len(request.Types))],
+			Prompt:   prompt,
+			answer:   answer,
+			wordUUID: word.UUID,
+		}
+		if question.Type == QuestionMultipleChoice {
+			choices := append(selectDistractors(words, answer, request.Direction, request.Choices-1, rnd), answer)
+			rnd.Shuffle(len(choices), func(i, j int) {
+				choices[i], choices[j] = choices[j], choices[i]
+			})
+			question.Choices = choices
+		}
+		session.Questions = append(session.Questions, question)
+	}
+	return session
+}
+
+func gradeQuizAnswer(question QuizQuestion, answer string, matching AnswerMatching) AnswerResult {
+	if question.Type == QuestionMultipleChoice {
+		if normalizeAnswer(answer) == normalizeAnswer(question.answer) {
+			return AnswerCorrect
+		}
+		return AnswerIncorrect
+	}
+	return checkAnswer(answer, question.answer, matching)
+}
+
+// expireQuizSessions removes old sessions, the caller holds quizLock
+func expireQuizSessions(now time.Time) {
+	for id, session := range quizSessions {
+		if now.Sub(session.Created) > QUIZ_SESSION_LIFETIME {
+			delete(quizSessions, id)
+		}
+	}
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func createQuiz(c *gin.Context) {
+	request := QuizRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("Quiz request is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid quiz request")
+		return
+	}
+	if request.Questions == 0 {
+		request.Questions = DEFAULT_QUIZ_QUESTIONS
+	}
+	if request.Choices == 0 {
+		request.Choices = DEFAULT_QUIZ_CHOICES
+	}
+	if request.Direction == "" {
+		request.Direction = DirectionForward
+	}
+	if len(request.Types) == 0 {
+		request.Types = []QuestionType{QuestionMultipleChoice}
+	}
+	if request.Questions < 0 || request.Questions > MAX_QUIZ_QUESTIONS || request.Choices < 2 || request.Choices > MAX_QUIZ_CHOICES {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "invalid number of questions or choices")
+		return
+	}
+	if !request.Direction.valid() {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "unknown direction")
+		return
+	}
+	for _, questionType := range request.Types {
+		if !questionType.valid() {
+			respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "unknown question type")
+			return
+		}
+	}
+	deck, ok := deckFilter(c)
+	if !ok {
+		respondProblem(c, http.StatusBadRequest, ErrDeckNotFound, "given deck does not exist")
+		return
+	}
+	words := vocabulary
+	if deck >= 0 {
+		words = wordsInDeck(vocabulary, deck)
+	}
+	if len(words) == 0 {
+		respondProblem(c, http.StatusConflict, ErrVocabularyEmpty, "vocabulary is empty")
+		return
+	}
+
+	now := time.Now()
+	rnd := rand.New(rand.NewSource(now.UnixNano()))
+	session := buildQuiz(words, request, userFromContext(c), now, rnd)
+	quizLock.Lock()
+	defer quizLock.Unlock()
+	expireQuizSessions(now)
+	quizSessions[session.ID] = session
+	log.Printf("Created quiz %s with %d questions", session.ID, len(session.Questions))
+	respond(c, http.StatusCreated, session)
+}
+
+func getQuiz(c *gin.Context) {
+	quizLock.Lock()
+	defer quizLock.Unlock()
+	session, ok := quizSessions[c.Param("session")]
+	if !ok || session.User != userFromContext(c) {
+		respondProblem(c, http.StatusNotFound, ErrQuizNotFound, "quiz not found")
+		return
+	}
+	respond(c, http.StatusOK, session)
+}
+
+func answerQuiz(c *gin.Context) {
+	user := userFromContext(c)
+	var answer QuizAnswer
+	if err := c.ShouldBindJSON(&answer); err != nil {
+		log.Printf("Quiz answer is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid answer")
+		return
+	}
+	quizLock.Lock()
+	defer quizLock.Unlock()
+	session, ok := quizSessions[c.Param("session")]
+	if !ok || session.User != user {
+		respondProblem(c, http.StatusNotFound, ErrQuizNotFound, "quiz not found")
+		return
+	}
+	if answer.Index < 0 || answer.Index >= len(session.Questions) {
+		respondProblem(c, http.StatusBadRequest, ErrQuestionNotFound, "given question does not exist")
+		return
+	}
+	question := &session.Questions[answer.Index]
+	if question.Answered {
+		respondProblem(c, http.StatusConflict, ErrAlreadyAnswered, "question already answered")
+		return
+	}
+	wordIdx := indexOfUUID(vocabulary, question.wordUUID)
+	if wordIdx < 0 {
+		respondProblem(c, http.StatusGone, ErrWordRemoved, "word was removed")
+		return
+	}
+
+	result := gradeQuizAnswer(*question, answer.Answer, userSettings[user].Matching)
+	question.Answered = true
+	question.Result = result
+	word := reviewWord(wordIdx, WordReview{
+		Grade:        result.grade(),
+		ResponseTime: answer.ResponseTime,
+		Direction:    session.Direction,
+	}, user, time.Now())
+	saveVocabularyV2(&vocabulary)
+	respond(c, http.StatusOK, QuizAnswerResult{
+		Index:    answer.Index,
+		Result:   result,
+		Grade:    result.grade(),
+		Expected: question.answer,
+		Word:     word,
+	})
+}
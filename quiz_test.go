@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var quizWords = []Word{
+	{ID: 0, UUID: "0", Vocabulary: "der Hund", Translation: "el perro"},
+	{ID: 1, UUID: "1", Vocabulary: "die Katze", Translation: "el gato"},
+	{ID: 2, UUID: "2", Vocabulary: "das Pferd", Translation: "el caballo"},
+	{ID: 3, UUID: "3", Vocabulary: "die Maus", Translation: "el ratón"},
+	{ID: 4, UUID: "4", Vocabulary: "der Vogel", Translation: "el pájaro"},
+	{ID: 5, UUID: "5", Vocabulary: "der Hund", Translation: "El Perro "},
+}
+
+func TestQuizDistractors(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	distractors := selectDistractors(quizWords, "el perro", DirectionForward, 3, rnd)
+	if len(distractors) != 3 {
+		log.Printf("Expected 3 distractors got %+v", distractors)
+		t.FailNow()
+	}
+	for _, d := range distractors {
+		// Neither the answer itself nor a spelling variant of it may show up
+		if d == "el perro" || d == "El Perro " {
+			log.Printf("Correct answer used as distractor: %+v", distractors)
+			t.FailNow()
+		}
+	}
+	// Not enough vocabulary for the requested amount of choices
+	distractors = selectDistractors(quizWords[:2], "el perro", DirectionForward, 3, rnd)
+	if len(distractors) != 1 || distractors[0] != "el gato" {
+		log.Printf("Unexpected distractors: %+v", distractors)
+		t.FailNow()
+	}
+	// Must not overflow for huge counts
+	if distractors = selectDistractors(quizWords, "el perro", DirectionForward, math.MaxInt, rnd); len(distractors) != 4 {
+		log.Printf("Unexpected distractors: %+v", distractors)
+		t.FailNow()
+	}
+}
+
+func TestBuildQuiz(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	words := append([]Word{}, quizWords...)
+	for idx := range words {
+		words[idx].Schedule.Due = now.AddDate(0, 0, 1)
+	}
+	words[3].Schedule.Due = now.AddDate(0, 0, -1)
+
+	request := QuizRequest{Questions: 3, Direction: DirectionReverse, Types: []QuestionType{QuestionMultipleChoice}, Choices: 4}
+	session := buildQuiz(words, request, "lerner", now, rand.New(rand.NewSource(1)))
+	if len(session.Questions) != 3 {
+		log.Printf("Expected 3 questions got %d", len(session.Questions))
+		t.FailNow()
+	}
+	// The only due word is always asked first
+	first := session.Questions[0]
+	if first.WordID != 3 || first.Prompt != "el ratón" || first.answer != "die Maus" {
+		log.Printf("Unexpected first question: %+v", first)
+		t.FailNow()
+	}
+	for _, question := range session.Questions {
+		if len(question.Choices) != 4 {
+			log.Printf("Expected 4 choices got %+v", question.Choices)
+			t.FailNow()
+		}
+		found := false
+		for _, choice := range question.Choices {
+			found = found || choice == question.answer
+		}
+		if !found {
+			log.Printf("Answer missing in choices: %+v", question)
+			t.FailNow()
+		}
+	}
+}
+
+func TestConcurrentQuizzes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/quiz", createQuiz)
+	router.GET("/quiz/:session", getQuiz)
+	vocabulary = append([]Word{}, quizWords...)
+	decks = []Deck{}
+
+	var wait sync.WaitGroup
+	for idx := 0; idx < 20; idx++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/quiz", strings.NewReader(`{"Questions": 2}`)))
+			var session QuizSession
+			json.Unmarshal(w.Body.Bytes(), &session)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/quiz/"+session.ID, nil))
+			if w.Code != http.StatusOK {
+				log.Printf("Quiz %s not found: %d", session.ID, w.Code)
+				t.Fail()
+			}
+		}()
+	}
+	wait.Wait()
+}
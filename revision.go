@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fingerprints of the words as they were stored the last time. Comparing
+// against them finds every changed word, no matter which handler changed it.
+// The fingerprints of the fields find the changed fields of a word.
+var wordFingerprints = map[string][sha256.Size]byte{}
+var fieldFingerprints = map[string]map[string]uint64{}
+
+func wordFingerprint(word Word) [sha256.Size]byte {
+	// The index, revision, sequence and versions are no content of the word
+	word.ID = 0
+	word.Revision = 0
+	word.Sequence = 0
+	word.Versions = nil
+	raw, _ := json.Marshal(word)
+	return sha256.Sum256(raw)
+}
+
+// stampRevisions increases the revision of every word whose content changed
+// since the last call. New words start with revision 1, words that were
+// stored with a revision before keep it. Every change takes the next number
+// of the change sequence, records the versions of the changed fields and
+// words which disappeared leave a tombstone.
+func stampRevisions(list []Word) {
+	now := time.Now()
+	for _, word := range list {
+		if word.Sequence > syncState.Sequence {
+			syncState.Sequence = word.Sequence
+		}
+	}
+	fingerprints := make(map[string][sha256.Size]byte, len(list))
+	fields := make(map[string]map[string]uint64, len(list))
+	appeared := []string{}
+	for idx := range list {
+		word := &list[idx]
+		fingerprint := wordFingerprint(*word)
+		previous, known := wordFingerprints[word.UUID]
+		changed := false
+		if !known && word.Revision == 0 {
+			word.Revision = 1
+			changed = true
+		} else if known && previous != fingerprint {
+			word.Revision += 1
+			changed = true
+		}
+		if changed || word.Sequence == 0 {
+			word.Sequence = nextSequence()
+		}
+		previousFields, tracked := fieldFingerprints[word.UUID]
+		if !known || changed || !tracked {
+			fields[word.UUID] = fieldHashes(*word)
+		} else {
+			fields[word.UUID] = previousFields
+		}
+		if known && changed && tracked {
+			stampFieldVersions(word, previousFields, fields[word.UUID], now)
+		}
+		if !known {
+			appeared = append(appeared, word.UUID)
+			observeVersions(*word, now)
+		}
+		fingerprints[word.UUID] = fingerprint
+	}
+	for uuid := range wordFingerprints {
+		if _, ok := fingerprints[uuid]; !ok {
+			recordTombstone(uuid, now)
+		}
+	}
+	forgetTombstones(appeared)
+	wordFingerprints = fingerprints
+	fieldFingerprints = fields
+}
+
+func wordETag(word Word) string {
+	return "\"" + word.UUID + ":" + strconv.Itoa(word.Revision) + "\""
+}
+
+// collectionETag is derived from the revisions of all words and the query, so
+// it changes with every change to the vocabulary and survives restarts.
+func collectionETag(list []Word, query string) string {
+	indices := make([]int, len(list))
+	for idx := range indices {
+		indices[idx] = idx
+	}
+	return selectionETag(list, indices, query)
+}
+
+// selectionETag is the collection ETag of the words at the given indices
+func selectionETag(words []Word, indices []int, query string) string {
+	h := fnv.New64a()
+	for _, idx := range indices {
+		h.Write([]byte(wordETag(words[idx])))
+	}
+	h.Write([]byte(query))
+	return "W/\"" + hex.EncodeToString(h.Sum(nil)) + "\""
+}
+
+// etagMatches checks an If-Match or If-None-Match header value, which may
+// contain a list of tags or "*". If-None-Match compares weakly, If-Match
+// strongly, so weak tags never match there (RFC 9110).
+func etagMatches(header string, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch makes sure the client modifies the revision of the word it
+// has seen. Requests without If-Match are rejected to prevent lost updates.
+func checkIfMatch(c *gin.Context, word Word) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		respondProblem(c, http.StatusPreconditionRequired, ErrPreconditionRequired, "If-Match header is missing")
+		return false
+	}
+	if !etagMatches(header, wordETag(word), false) {
+		log.Printf("Stale modification of %s: %s", wordETag(word), header)
+		c.Header("ETag", wordETag(word))
+		respondProblem(c, http.StatusPreconditionFailed, ErrPreconditionFailed, "word was modified in the meantime")
+		return false
+	}
+	return true
+}
+
+// checkBaseRevision returns the revision of the word named in If-Match.
+// Unlike checkIfMatch older revisions are accepted, the caller merges the
+// changes made since then.
+func checkBaseRevision(c *gin.Context, word Word) (int, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		respondProblem(c, http.StatusPreconditionRequired, ErrPreconditionRequired, "If-Match header is missing")
+		return 0, false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return word.Revision, true
+		}
+		// Weak tags are not allowed in If-Match
+		if revision, found := strings.CutPrefix(candidate, "\""+word.UUID+":"); found && strings.HasSuffix(revision, "\"") {
+			revision = strings.TrimSuffix(revision, "\"")
+			base, err := strconv.Atoi(revision)
+			if err == nil && base > 0 && base <= word.Revision {
+				return base, true
+			}
+		}
+	}
+	log.Printf("Unknown revision of %s: %s", word.UUID, header)
+	c.Header("ETag", wordETag(word))
+	respondProblem(c, http.StatusPreconditionFailed, ErrPreconditionFailed, "unknown revision of the word")
+	return 0, false
+}
+
+// checkIfNoneMatch answers with 304 if the client already has the current
+// representation.
+func checkIfNoneMatch(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStampRevisions(t *testing.T) {
+	wordFingerprints = map[string][32]byte{}
+	words := []Word{{UUID: "a", Vocabulary: "Hund"}, {UUID: "b", Vocabulary: "Katze", Revision: 7}}
+	stampRevisions(words)
+	if words[0].Revision != 1 || words[1].Revision != 7 {
+		log.Printf("Unexpected initial revisions: %+v", words)
+		t.FailNow()
+	}
+
+	// Changing the index only does not create a new revision
+	words = []Word{words[1], words[0]}
+	words[0].ID, words[1].ID = 0, 1
+	words[1].Confidence = 50
+	stampRevisions(words)
+	if words[0].Revision != 7 || words[1].Revision != 2 {
+		log.Printf("Unexpected revisions: %+v", words)
+		t.FailNow()
+	}
+	stampRevisions(words)
+	if words[1].Revision != 2 {
+		t.FailNow()
+	}
+}
+
+func TestETagPreconditions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	word := Word{UUID: "a", Revision: 3}
+	cases := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{"\"a:2\"", http.StatusPreconditionFailed},
+		{"\"b:3\"", http.StatusPreconditionFailed},
+		{"\"b:1\", \"a:3\"", http.StatusOK},
+		// Weak tags never match If-Match
+		{"W/\"a:3\"", http.StatusPreconditionFailed},
+		{"*", http.StatusOK},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("DELETE", "/words/0", nil)
+		if test.header != "" {
+			c.Request.Header.Set("If-Match", test.header)
+		}
+		if ok := checkIfMatch(c, word); ok != (test.status == http.StatusOK) || (!ok && w.Code != test.status) {
+			log.Printf("If-Match %q: expected %d got %d", test.header, test.status, w.Code)
+			t.Fail()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/words", nil)
+	etag := collectionETag([]Word{word}, "")
+	c.Request.Header.Set("If-None-Match", etag)
+	if !checkIfNoneMatch(c, etag) || collectionETag([]Word{word}, "tag=food") == etag {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Grade is the answer quality reported by a client after reviewing a word.
+// The scale follows the common four button layout (again, hard, good, easy).
+type Grade int
+
+const (
+	GradeAgain Grade = 1
+	GradeHard  Grade = 2
+	GradeGood  Grade = 3
+	GradeEasy  Grade = 4
+)
+
+func (g Grade) valid() bool {
+	return g >= GradeAgain && g <= GradeEasy
+}
+
+// Schedule holds the learning state of a single word. Not every algorithm
+// uses every field, unused fields are simply kept as they are.
+type Schedule struct {
+	Due         time.Time
+	LastReview  time.Time
+	Interval    int // in days
+	Repetitions int
+	Lapses      int
+	Ease        float64 // SM-2
+	Box         int     // Leitner
+	Stability   float64 // FSRS
+	Difficulty  float64 // FSRS
+}
+
+// Scheduler computes the next learning state of a word after a review.
+// Implementations must be deterministic and only depend on their input.
+type Scheduler interface {
+	Name() string
+	Next(state Schedule, grade Grade, now time.Time) Schedule
+}
+
+const DEFAULT_SCHEDULER = "sm2"
+
+var schedulers = map[string]Scheduler{
+	"sm2":     SM2Scheduler{},
+	"leitner": LeitnerScheduler{Intervals: []int{1, 2, 4, 8, 16}},
+	"fsrs":    NewFSRSScheduler(),
+}
+
+func lookupScheduler(name string) (Scheduler, bool) {
+	s, ok := schedulers[name]
+	return s, ok
+}
+
+func availableSchedulers() []string {
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func addDays(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, days)
+}
+
+// -------------------------------------------------------------------------------
+// SM-2
+// -------------------------------------------------------------------------------
+
+// SM2Scheduler implements the SuperMemo 2 algorithm. The four button grade is
+// mapped onto the original 0-5 quality scale.
+type SM2Scheduler struct{}
+
+func (SM2Scheduler) Name() string {
+	return "sm2"
+}
+
+func sm2Quality(grade Grade) float64 {
+	switch grade {
+	case GradeAgain:
+		return 1
+	case GradeHard:
+		return 3
+	case GradeGood:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func (SM2Scheduler) Next(state Schedule, grade Grade, now time.Time) Schedule {
+	q := sm2Quality(grade)
+	if state.Ease == 0 {
+		state.Ease = 2.5
+	}
+	if q < 3 {
+		state.Repetitions = 0
+		state.Interval = 1
+		state.Lapses += 1
+	} else {
+		switch state.Repetitions {
+		case 0:
+			state.Interval = 1
+		case 1:
+			state.Interval = 6
+		default:
+			state.Interval = int(math.Round(float64(state.Interval) * state.Ease))
+		}
+		state.Repetitions += 1
+	}
+	state.Ease = state.Ease + (0.1 - (5-q)*(0.08+(5-q)*0.02))
+	if state.Ease < 1.3 {
+		state.Ease = 1.3
+	}
+	state.LastReview = now
+	state.Due = addDays(now, state.Interval)
+	return state
+}
+
+// -------------------------------------------------------------------------------
+// Leitner
+// -------------------------------------------------------------------------------
+
+// LeitnerScheduler implements the classic Leitner box system. Intervals holds
+// the review interval in days for each box, starting with box 1.
+type LeitnerScheduler struct {
+	Intervals []int
+}
+
+func (LeitnerScheduler) Name() string {
+	return "leitner"
+}
+
+func (l LeitnerScheduler) Next(state Schedule, grade Grade, now time.Time) Schedule {
+	if state.Box < 1 {
+		state.Box = 1
+	}
+	switch grade {
+	case GradeAgain:
+		state.Box = 1
+		state.Lapses += 1
+	case GradeHard:
+		// Stay in the current box
+	default:
+		if state.Box < len(l.Intervals) {
+			state.Box += 1
+		}
+	}
+	state.Repetitions += 1
+	state.Interval = l.Intervals[state.Box-1]
+	state.LastReview = now
+	state.Due = addDays(now, state.Interval)
+	return state
+}
+
+// -------------------------------------------------------------------------------
+// FSRS
+// -------------------------------------------------------------------------------
+
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0
+)
+
+// FSRSScheduler implements the Free Spaced Repetition Scheduler (v4.5) with
+// the published default weights.
+type FSRSScheduler struct {
+	Weights          [17]float64
+	RequestRetention float64
+	MaximumInterval  int
+}
+
+func NewFSRSScheduler() FSRSScheduler {
+	return FSRSScheduler{
+		Weights: [17]float64{
+			0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031,
+			1.6474, 0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+		},
+		RequestRetention: 0.9,
+		MaximumInterval:  36500,
+	}
+}
+
+func (FSRSScheduler) Name() string {
+	return "fsrs"
+}
+
+func clamp(value float64, min float64, max float64) float64 {
+	return math.Min(math.Max(value, min), max)
+}
+
+func (f FSRSScheduler) initStability(grade Grade) float64 {
+	return math.Max(f.Weights[grade-1], 0.1)
+}
+
+func (f FSRSScheduler) initDifficulty(grade Grade) float64 {
+	return clamp(f.Weights[4]-float64(grade-3)*f.Weights[5], 1, 10)
+}
+
+func (f FSRSScheduler) nextDifficulty(difficulty float64, grade Grade) float64 {
+	next := difficulty - f.Weights[6]*float64(grade-3)
+	// Mean reversion towards the difficulty of a "good" first answer
+	next = f.Weights[7]*f.initDifficulty(GradeGood) + (1-f.Weights[7])*next
+	return clamp(next, 1, 10)
+}
+
+func (f FSRSScheduler) recallStability(difficulty float64, stability float64, retrievability float64, grade Grade) float64 {
+	hardPenalty := 1.0
+	if grade == GradeHard {
+		hardPenalty = f.Weights[15]
+	}
+	easyBonus := 1.0
+	if grade == GradeEasy {
+		easyBonus = f.Weights[16]
+	}
+	return stability * (1 + math.Exp(f.Weights[8])*
+		(11-difficulty)*
+		math.Pow(stability, -f.Weights[9])*
+		(math.Exp((1-retrievability)*f.Weights[10])-1)*
+		hardPenalty*
+		easyBonus)
+}
+
+func (f FSRSScheduler) forgetStability(difficulty float64, stability float64, retrievability float64) float64 {
+	return f.Weights[11] *
+		math.Pow(difficulty, -f.Weights[12]) *
+		(math.Pow(stability+1, f.Weights[13]) - 1) *
+		math.Exp((1-retrievability)*f.Weights[14])
+}
+
+func (f FSRSScheduler) nextInterval(stability float64) int {
+	interval := stability / fsrsFactor * (math.Pow(f.RequestRetention, 1/fsrsDecay) - 1)
+	return int(clamp(math.Round(interval), 1, float64(f.MaximumInterval)))
+}
+
+func (f FSRSScheduler) Next(state Schedule, grade Grade, now time.Time) Schedule {
+	if state.Stability == 0 {
+		state.Stability = f.initStability(grade)
+		state.Difficulty = f.initDifficulty(grade)
+	} else {
+		elapsed := math.Max(now.Sub(state.LastReview).Hours()/24, 0)
+		retrievability := math.Pow(1+fsrsFactor*elapsed/state.Stability, fsrsDecay)
+		if grade == GradeAgain {
+			state.Stability = f.forgetStability(state.Difficulty, state.Stability, retrievability)
+		} else {
+			state.Stability = f.recallStability(state.Difficulty, state.Stability, retrievability, grade)
+		}
+		state.Difficulty = f.nextDifficulty(state.Difficulty, grade)
+	}
+	if grade == GradeAgain {
+		state.Lapses += 1
+		state.Interval = 1
+	} else {
+		state.Interval = f.nextInterval(state.Stability)
+	}
+	state.Repetitions += 1
+	state.LastReview = now
+	state.Due = addDays(now, state.Interval)
+	return state
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"math"
+	"testing"
+	"time"
+)
+
+var reviewStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type scheduleStep struct {
+	grade    Grade
+	interval int
+}
+
+// runSchedule reviews a fresh word with the given grades, always answering
+// exactly when the word becomes due, and checks the resulting intervals.
+func runSchedule(scheduler Scheduler, steps []scheduleStep) (Schedule, bool) {
+	state := Schedule{}
+	now := reviewStart
+	for idx, step := range steps {
+		state = scheduler.Next(state, step.grade, now)
+		if state.Interval != step.interval {
+			log.Printf("%s step %d: expected interval %d got %d", scheduler.Name(), idx, step.interval, state.Interval)
+			return state, false
+		}
+		if !state.Due.Equal(now.AddDate(0, 0, step.interval)) {
+			log.Printf("%s step %d: due date %s does not match interval", scheduler.Name(), idx, state.Due)
+			return state, false
+		}
+		now = state.Due
+	}
+	return state, true
+}
+
+func TestSM2Intervals(t *testing.T) {
+	state, ok := runSchedule(SM2Scheduler{}, []scheduleStep{
+		{GradeGood, 1},
+		{GradeGood, 6},
+		{GradeGood, 15},
+		{GradeGood, 38},
+		{GradeAgain, 1},
+		{GradeGood, 1},
+		{GradeGood, 6},
+	})
+	if !ok {
+		t.FailNow()
+	}
+	if state.Lapses != 1 || state.Repetitions != 2 {
+		log.Printf("Unexpected counters: %+v", state)
+		t.FailNow()
+	}
+	// One "again" answer lowers the ease by 0.54
+	if math.Abs(state.Ease-1.96) > 1e-9 {
+		log.Printf("Expected ease 1.96 got %f", state.Ease)
+		t.FailNow()
+	}
+}
+
+func TestSM2MinimumEase(t *testing.T) {
+	state := Schedule{}
+	for i := 0; i < 10; i++ {
+		state = SM2Scheduler{}.Next(state, GradeAgain, reviewStart)
+	}
+	if state.Ease != 1.3 {
+		log.Printf("Ease dropped below minimum: %f", state.Ease)
+		t.FailNow()
+	}
+}
+
+func TestLeitnerIntervals(t *testing.T) {
+	state, ok := runSchedule(schedulers["leitner"], []scheduleStep{
+		{GradeGood, 2},
+		{GradeEasy, 4},
+		{GradeHard, 4},
+		{GradeGood, 8},
+		{GradeGood, 16},
+		{GradeGood, 16},
+		{GradeAgain, 1},
+		{GradeGood, 2},
+	})
+	if !ok {
+		t.FailNow()
+	}
+	if state.Box != 2 || state.Lapses != 1 {
+		log.Printf("Unexpected box state: %+v", state)
+		t.FailNow()
+	}
+}
+
+func TestFSRSIntervals(t *testing.T) {
+	state, ok := runSchedule(NewFSRSScheduler(), []scheduleStep{
+		{GradeGood, 4},
+		{GradeGood, 15},
+		{GradeAgain, 1},
+	})
+	if !ok {
+		t.FailNow()
+	}
+	if math.Abs(state.Stability-3.149321) > 1e-6 || math.Abs(state.Difficulty-6.901155) > 1e-6 {
+		log.Printf("Unexpected memory state: %+v", state)
+		t.FailNow()
+	}
+	_, ok = runSchedule(NewFSRSScheduler(), []scheduleStep{
+		{GradeEasy, 14},
+	})
+	if !ok {
+		t.FailNow()
+	}
+}
+
+func TestSchedulerSelection(t *testing.T) {
+	userSettings = map[string]UserSettings{"fsrs-user": {Scheduler: "fsrs"}}
+	if schedulerForUser("fsrs-user").Name() != "fsrs" {
+		t.FailNow()
+	}
+	if schedulerForUser("unknown").Name() != DEFAULT_SCHEDULER {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULT_SEARCH_RESULTS = 20
+	MAX_SEARCH_RESULTS     = 100
+)
+
+// Field weights used when ranking search results
+const (
+	weightVocabulary  = 3
+	weightTranslation = 2
+	weightDetails     = 1
+)
+
+type SearchResult struct {
+	Score float64
+	Word  Word
+}
+
+// SearchIndex is an inverted index from normalized tokens to the words (by
+// UUID) containing them. The sorted token list is used for prefix lookups.
+type SearchIndex struct {
+	postings map[string]map[string]int // token -> uuid -> field weight
+	words    map[string][]string       // uuid -> tokens, needed for removal
+	tokens   []string
+	dirty    bool
+}
+
+var searchIndex = newSearchIndex()
+
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		postings: map[string]map[string]int{},
+		words:    map[string][]string{},
+	}
+}
+
+// searchTokens splits a text into lowercase tokens without accents. The
+// German sharp s is folded as well, since it is often typed as "ss".
+func searchTokens(text string) []string {
+	normalized := removeAccents(strings.ToLower(normalizeAnswer(text)))
+	normalized = strings.ReplaceAll(normalized, "ß", "ss")
+	return strings.FieldsFunc(normalized, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func wordFields(word Word) map[string]int {
+	fields := map[string]int{}
+	add := func(text string, weight int) {
+		for _, token := range searchTokens(text) {
+			if fields[token] < weight {
+				fields[token] = weight
+			}
+		}
+	}
+	add(word.Vocabulary, weightVocabulary)
+	add(word.Translation, weightTranslation)
+	for _, translation := range word.Translations {
+		add(translation, weightTranslation)
+	}
+	add(word.Notes, weightDetails)
+	add(word.Plural, weightDetails)
+	for _, example := range word.Examples {
+		add(example.Sentence, weightDetails)
+		add(example.Translation, weightDetails)
+	}
+	for _, synonym := range word.Synonyms {
+		add(synonym, weightDetails)
+	}
+	return fields
+}
+
+func (s *SearchIndex) add(word Word) {
+	s.remove(word.UUID)
+	tokens := []string{}
+	for token, weight := range wordFields(word) {
+		if s.postings[token] == nil {
+			s.postings[token] = map[string]int{}
+			s.dirty = true
+		}
+		s.postings[token][word.UUID] = weight
+		tokens = append(tokens, token)
+	}
+	s.words[word.UUID] = tokens
+}
+
+func (s *SearchIndex) remove(uuid string) {
+	for _, token := range s.words[uuid] {
+		delete(s.postings[token], uuid)
+		if len(s.postings[token]) == 0 {
+			delete(s.postings, token)
+			s.dirty = true
+		}
+	}
+	delete(s.words, uuid)
+}
+
+func (s *SearchIndex) sortedTokens() []string {
+	if s.dirty || s.tokens == nil {
+		s.tokens = make([]string, 0, len(s.postings))
+		for token := range s.postings {
+			s.tokens = append(s.tokens, token)
+		}
+		sort.Strings(s.tokens)
+		s.dirty = false
+	}
+	return s.tokens
+}
+
+// allowedTypos returns the edit distance tolerated for a query token. Short
+// tokens have to match exactly, otherwise almost everything would match.
+func allowedTypos(token string) int {
+	length := len([]rune(token))
+	switch {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// scoreToken rates all words for a single query token. Exact matches score
+// highest, followed by prefix matches and matches with typos.
+func (s *SearchIndex) scoreToken(query string) map[string]float64 {
+	scores := map[string]float64{}
+	addPostings := func(token string, factor float64) {
+		for uuid, weight := range s.postings[token] {
+			if score := factor * float64(weight); score > scores[uuid] {
+				scores[uuid] = score
+			}
+		}
+	}
+
+	tokens := s.sortedTokens()
+	start := sort.SearchStrings(tokens, query)
+	for idx := start; idx < len(tokens) && strings.HasPrefix(tokens[idx], query); idx++ {
+		if tokens[idx] == query {
+			addPostings(tokens[idx], 3)
+		} else {
+			addPostings(tokens[idx], 2)
+		}
+	}
+
+	typos := allowedTypos(query)
+	if typos == 0 {
+		return scores
+	}
+	queryLength := len([]rune(query))
+	for _, token := range tokens {
+		diff := len([]rune(token)) - queryLength
+		if diff > typos || diff < -typos {
+			continue
+		}
+		if distance := levenshtein(query, token); distance > 0 && distance <= typos {
+			addPostings(token, 1/float64(distance))
+		}
+	}
+	return scores
+}
+
+func (s *SearchIndex) search(query string) map[string]float64 {
+	scores := map[string]float64{}
+	for _, token := range searchTokens(query) {
+		for uuid, score := range s.scoreToken(token) {
+			scores[uuid] += score
+		}
+	}
+	return scores
+}
+
+func rebuildSearchIndex() {
+	searchIndex = newSearchIndex()
+	for _, word := range vocabulary {
+		searchIndex.add(word)
+	}
+}
+
+func searchWords(words []Word, query string, limit int) []SearchResult {
+	scores := searchIndex.search(query)
+	results := []SearchResult{}
+	for _, word := range words {
+		if score, ok := scores[word.UUID]; ok {
+			results = append(results, SearchResult{Score: score, Word: word})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func searchData(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "search query is missing")
+		return
+	}
+	limit := DEFAULT_SEARCH_RESULTS
+	if param, ok := c.GetQuery("limit"); ok {
+		value, err := strconv.Atoi(param)
+		if err != nil || value < 1 || value > MAX_SEARCH_RESULTS {
+			respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "limit out of range")
+			return
+		}
+		limit = value
+	}
+	respond(c, http.StatusOK, searchWords(vocabulary, query, limit))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"testing"
+)
+
+func searchedUUIDs(query string) []string {
+	uuids := []string{}
+	for _, result := range searchWords(vocabulary, query, MAX_SEARCH_RESULTS) {
+		uuids = append(uuids, result.Word.UUID)
+	}
+	return uuids
+}
+
+func TestSearchIndex(t *testing.T) {
+	vocabulary = []Word{
+		{UUID: "a", Vocabulary: "der Schmetterling", Translation: "la mariposa"},
+		{UUID: "b", Vocabulary: "die Straße", Translation: "la calle", Notes: "Schmetterlinge fliegen über die Straße"},
+		{UUID: "c", Vocabulary: "das Café", Translation: "el café", Translations: map[string]string{"it": "il caffè"}},
+	}
+	rebuildSearchIndex()
+
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		// Matches in the vocabulary rank higher than matches in notes
+		{"schmetterling", []string{"a", "b"}},
+		{"Schmet", []string{"a", "b"}},
+		{"strasse", []string{"b"}},
+		{"strase", []string{"b"}},
+		{"cafe", []string{"c"}},
+		{"caffe", []string{"c"}},
+		{"mariposs", []string{"a"}},
+		{"xyz", []string{}},
+	}
+	for _, test := range cases {
+		result := searchedUUIDs(test.query)
+		if len(result) != len(test.expected) {
+			log.Printf("Query %q: expected %v got %v", test.query, test.expected, result)
+			t.Fail()
+			continue
+		}
+		for idx := range result {
+			if result[idx] != test.expected[idx] {
+				log.Printf("Query %q: expected %v got %v", test.query, test.expected, result)
+				t.Fail()
+			}
+		}
+	}
+
+	// The index follows changes of the vocabulary
+	vocabulary[0].Vocabulary = "die Raupe"
+	searchIndex.add(vocabulary[0])
+	searchIndex.remove("b")
+	vocabulary = vocabulary[:1]
+	if result := searchedUUIDs("schmetterling"); len(result) != 0 {
+		log.Printf("Index not updated: %v", result)
+		t.FailNow()
+	}
+	if result := searchedUUIDs("raupe"); len(result) != 1 {
+		log.Printf("Index not updated: %v", result)
+		t.FailNow()
+	}
+}
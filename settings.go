@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+const SETTINGS_FILE = "settings.json"
+
+type UserSettings struct {
+	Scheduler string
+	Matching  AnswerMatching
+}
+
+var userSettings = map[string]UserSettings{}
+
+func readSettings() map[string]UserSettings {
+	log.Print("Reading existing user settings")
+	content, err := os.ReadFile(SETTINGS_FILE)
+	if err != nil || string(content) == "" {
+		log.Print("No user settings found. Using defaults...")
+		return map[string]UserSettings{}
+	}
+	var settings map[string]UserSettings
+	err = json.Unmarshal(content, &settings)
+	if err != nil {
+		log.Print("The given file does not contain valid user settings!")
+		return map[string]UserSettings{}
+	}
+	return settings
+}
+
+func saveSettings(settings map[string]UserSettings) {
+	log.Print("Storing the user settings")
+	rawData, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil {
+		log.Print("Failed to convert settings to JSON!")
+		return
+	}
+	err = os.WriteFile(SETTINGS_FILE, rawData, 0644)
+	if err != nil {
+		log.Printf("Failed to write file \"%s\"", SETTINGS_FILE)
+	}
+}
+
+func userFromContext(c *gin.Context) string {
+	userId, exists := c.Get("userId")
+	if !exists {
+		return ""
+	}
+	user, ok := userId.(string)
+	if !ok {
+		return ""
+	}
+	return user
+}
+
+// schedulerForUser returns the scheduling algorithm selected by the given
+// user or the default algorithm if nothing was selected.
+func schedulerForUser(user string) Scheduler {
+	if s, ok := lookupScheduler(userSettings[user].Scheduler); ok {
+		return s
+	}
+	s, _ := lookupScheduler(DEFAULT_SCHEDULER)
+	return s
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getSettings(c *gin.Context) {
+	user := userFromContext(c)
+	settings := userSettings[user]
+	settings.Scheduler = schedulerForUser(user).Name()
+	respond(c, http.StatusOK, gin.H{"settings": settings, "schedulers": availableSchedulers()})
+}
+
+func modifySettings(c *gin.Context) {
+	var settings UserSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		log.Printf("Settings are in incorrect format: %s", err)
+		respondBindError(c, err, "invalid settings")
+		return
+	}
+	if settings.Scheduler == "" {
+		settings.Scheduler = DEFAULT_SCHEDULER
+	}
+	if _, ok := lookupScheduler(settings.Scheduler); !ok {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "unknown scheduler")
+		return
+	}
+	if threshold := settings.Matching.TypoThreshold; threshold != nil && (*threshold < 0 || *threshold > 1) {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "typo threshold out of range")
+		return
+	}
+	userSettings[userFromContext(c)] = settings
+	saveSettings(userSettings)
+	respond(c, http.StatusOK, settings)
+}
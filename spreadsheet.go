@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CSV_CONTENT_TYPE = "text/csv"
+	TSV_CONTENT_TYPE = "text/tab-separated-values"
+)
+
+type DuplicateMode string
+
+const (
+	DuplicateSkip   DuplicateMode = "skip"
+	DuplicateUpdate DuplicateMode = "update"
+	DuplicateCreate DuplicateMode = "create"
+)
+
+type ImportAction string
+
+const (
+	ImportAdd     ImportAction = "add"
+	ImportUpdate  ImportAction = "update"
+	ImportSkip    ImportAction = "skip"
+	ImportInvalid ImportAction = "invalid"
+)
+
+// ImportRow reports what happened (or would happen in a dry run) with a
+// single line of the file.
+type ImportRow struct {
+	Line       int
+	Action     ImportAction
+	Vocabulary string
+	UUID       string // of the added or updated word
+	Reason     string
+	Errors     []FieldError
+}
+
+type ImportReport struct {
+	DryRun  bool
+	Added   int
+	Updated int
+	Skipped int
+	Invalid int
+	Rows    []ImportRow
+}
+
+// importLine holds the values of a line as setters for the word fields.
+// Packages of other learning programs also carry the learning progress and
+// the name of the deck.
+type importLine struct {
+	line       int
+	setters    []func(*Word)
+	deckName   string
+	events     []ReviewEvent
+	confidence int
+	repeat     int
+}
+
+type ImportOptions struct {
+	Duplicates DuplicateMode
+	Deck       int // negative keeps the deck of the words
+	DryRun     bool
+}
+
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';'
+	})
+}
+
+// importColumns maps the column names to the word fields they are stored in.
+// Lists are appended to, so importing into an existing word keeps its tags.
+var importColumns = map[string]func(word *Word, value string){
+	"vocabulary":     func(word *Word, value string) { word.Vocabulary = value },
+	"translation":    func(word *Word, value string) { word.Translation = value },
+	"tags":           func(word *Word, value string) { word.Tags = append(word.Tags, splitList(value)...) },
+	"notes":          func(word *Word, value string) { word.Notes = value },
+	"sourcelanguage": func(word *Word, value string) { word.SourceLanguage = value },
+	"targetlanguage": func(word *Word, value string) { word.TargetLanguage = value },
+	"partofspeech":   func(word *Word, value string) { word.PartOfSpeech = value },
+	"gender":         func(word *Word, value string) { word.Gender = value },
+	"article":        func(word *Word, value string) { word.Article = value },
+	"plural":         func(word *Word, value string) { word.Plural = value },
+	"synonyms":       func(word *Word, value string) { word.Synonyms = appendMissing(word.Synonyms, splitList(value)...) },
+	"antonyms":       func(word *Word, value string) { word.Antonyms = appendMissing(word.Antonyms, splitList(value)...) },
+}
+
+// exportColumns are written in this order, the header uses the same names as
+// the import so exported files can be imported again without a mapping.
+var exportColumns = []struct {
+	name  string
+	value func(word Word) string
+}{
+	{"vocabulary", func(word Word) string { return word.Vocabulary }},
+	{"translation", func(word Word) string { return word.Translation }},
+	{"tags", func(word Word) string { return strings.Join(word.Tags, ", ") }},
+	{"notes", func(word Word) string { return word.Notes }},
+	{"sourcelanguage", func(word Word) string { return word.SourceLanguage }},
+	{"targetlanguage", func(word Word) string { return word.TargetLanguage }},
+	{"partofspeech", func(word Word) string { return word.PartOfSpeech }},
+	{"gender", func(word Word) string { return word.Gender }},
+	{"article", func(word Word) string { return word.Article }},
+	{"plural", func(word Word) string { return word.Plural }},
+	{"synonyms", func(word Word) string { return strings.Join(word.Synonyms, ", ") }},
+	{"antonyms", func(word Word) string { return strings.Join(word.Antonyms, ", ") }},
+}
+
+// quizletSeparators are the names of the separators Quizlet offers for its
+// export. Any other value is used as the separator itself.
+var quizletSeparators = map[string]string{
+	"tab":       "\t",
+	"comma":     ",",
+	"newline":   "\n",
+	"semicolon": ";",
+}
+
+func separatorFor(format string) (rune, string, bool) {
+	switch format {
+	case "csv":
+		return ',', CSV_CONTENT_TYPE, true
+	case "tsv":
+		return '\t', TSV_CONTENT_TYPE, true
+	}
+	return 0, "", false
+}
+
+// formulaCell tells if spreadsheet programs would evaluate the value as a
+// formula, also after removing the quotes that escape it.
+func formulaCell(value string) bool {
+	value = strings.TrimLeft(value, "'")
+	return value != "" && strings.ContainsRune("=+-@", rune(value[0]))
+}
+
+// escapeCell quotes values that would be evaluated as formulas when the
+// export is opened in a spreadsheet program. The import removes the quote.
+func escapeCell(value string) string {
+	if formulaCell(value) {
+		return "'" + value
+	}
+	return value
+}
+
+func unescapeCell(value string) string {
+	if strings.HasPrefix(value, "'") && formulaCell(value[1:]) {
+		return value[1:]
+	}
+	return value
+}
+
+func exportWords(w io.Writer, words []Word, separator rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	header := make([]string, len(exportColumns))
+	for idx, column := range exportColumns {
+		header[idx] = column.name
+	}
+	writer.Write(header)
+	for _, word := range words {
+		record := make([]string, len(exportColumns))
+		for idx, column := range exportColumns {
+			record[idx] = escapeCell(column.value(word))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseColumnMapping reads mappings like "vocabulary=Wort" that tell which
+// header belongs to which field. Unmapped fields use their own name.
+func parseColumnMapping(mappings []string) (map[string]string, string) {
+	mapping := map[string]string{}
+	for _, entry := range mappings {
+		field, header, found := strings.Cut(entry, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, known := importColumns[field]; !found || !known {
+			return nil, "invalid column mapping " + entry
+		}
+		mapping[field] = strings.TrimSpace(header)
+	}
+	return mapping, ""
+}
+
+// readQuizlet parses the export of a Quizlet set. It has no header, every
+// card consists of the term and the definition.
+func readQuizlet(content string, termSeparator string, cardSeparator string) ([]importLine, string) {
+	if named, ok := quizletSeparators[termSeparator]; ok {
+		termSeparator = named
+	}
+	if named, ok := quizletSeparators[cardSeparator]; ok {
+		cardSeparator = named
+	}
+	if termSeparator == "" || cardSeparator == "" || termSeparator == cardSeparator {
+		return nil, "invalid separators"
+	}
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := []importLine{}
+	for idx, card := range strings.Split(content, cardSeparator) {
+		if strings.TrimSpace(card) == "" {
+			continue
+		}
+		term, definition, _ := strings.Cut(card, termSeparator)
+		term, definition = strings.TrimSpace(term), strings.TrimSpace(definition)
+		setters := []func(*Word){func(word *Word) { word.Vocabulary = term }}
+		if definition != "" {
+			setters = append(setters, func(word *Word) { word.Translation = definition })
+		}
+		lines = append(lines, importLine{line: idx + 1, setters: setters})
+	}
+	return lines, ""
+}
+
+// readImport parses the file and returns the values of the mapped columns for
+// every line.
+func readImport(r io.Reader, separator rune, mapping map[string]string) ([]importLine, string) {
+	reader := csv.NewReader(r)
+	reader.Comma = separator
+	reader.FieldsPerRecord = -1
+	// Tab separated files are rarely quoted correctly and trimming leading
+	// space would swallow empty columns
+	reader.LazyQuotes = separator == '\t'
+	reader.TrimLeadingSpace = separator != '\t'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, "header is missing"
+	}
+	// Spreadsheet programs like to start the file with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	fields := make([]string, len(header))
+	found := map[string]bool{}
+	for idx, name := range header {
+		for field := range importColumns {
+			expected, mapped := mapping[field]
+			if !mapped {
+				expected = field
+			}
+			if strings.EqualFold(strings.TrimSpace(name), expected) {
+				fields[idx] = field
+				found[field] = true
+			}
+		}
+	}
+	for field, name := range mapping {
+		if !found[field] {
+			return nil, "column " + name + " does not exist"
+		}
+	}
+	if !found["vocabulary"] || !found["translation"] {
+		return nil, "vocabulary or translation column is missing"
+	}
+
+	lines := []importLine{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err.Error()
+		}
+		line, _ := reader.FieldPos(0)
+		setters := []func(*Word){}
+		for idx, value := range record {
+			value = strings.TrimSpace(value)
+			if idx >= len(fields) || fields[idx] == "" || value == "" {
+				continue
+			}
+			set, value := importColumns[fields[idx]], unescapeCell(value)
+			setters = append(setters, func(word *Word) { set(word, value) })
+		}
+		lines = append(lines, importLine{line: line, setters: setters})
+	}
+	return lines, ""
+}
+
+// applyImport adds the imported lines to a copy of the words. Invalid lines
+// are reported and skipped, the other lines are imported nonetheless.
+func applyImport(words []Word, lines []importLine, options ImportOptions, now time.Time) ([]Word, ImportReport) {
+	working := make([]Word, len(words))
+	for idx := range words {
+		working[idx] = cloneWord(words[idx])
+	}
+	report := ImportReport{DryRun: options.DryRun, Rows: []ImportRow{}}
+	for _, line := range lines {
+		row := ImportRow{Line: line.line}
+		imported := Word{}
+		for _, set := range line.setters {
+			set(&imported)
+		}
+		if options.Deck >= 0 {
+			imported.Deck = options.Deck
+		}
+		normalizeWord(&imported)
+		row.Vocabulary = imported.Vocabulary
+
+		existing, duplicate := findDuplicate(working, imported)
+		switch {
+		case duplicate && options.Duplicates == DuplicateSkip:
+			row.Action = ImportSkip
+			row.Reason = "word already exists"
+		case duplicate && options.Duplicates == DuplicateUpdate:
+			updated := cloneWord(working[existing])
+			for _, set := range line.setters {
+				set(&updated)
+			}
+			if options.Deck >= 0 {
+				updated.Deck = options.Deck
+			}
+			normalizeWord(&updated)
+			if row.Errors = validateWord(updated); len(row.Errors) > 0 {
+				row.Action = ImportInvalid
+				break
+			}
+			working[existing] = updated
+			row.Action = ImportUpdate
+			row.UUID = updated.UUID
+		default:
+			if row.Errors = validateWord(imported); len(row.Errors) > 0 {
+				row.Action = ImportInvalid
+				break
+			}
+			imported.UUID = newUUID()
+			imported.Created = now
+			working = append(working, imported)
+			row.Action = ImportAdd
+			row.UUID = imported.UUID
+		}
+
+		switch row.Action {
+		case ImportAdd:
+			report.Added += 1
+		case ImportUpdate:
+			report.Updated += 1
+		case ImportSkip:
+			report.Skipped += 1
+		case ImportInvalid:
+			report.Invalid += 1
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return working, report
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+// exportData writes the words matching the filter as CSV, TSV or Anki
+// package. Exporting a single deck keeps its name in the package.
+func exportData(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	separator, contentType, ok := separatorFor(format)
+	if !ok && format != "apkg" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "format must be csv, tsv or apkg")
+		return
+	}
+	filter, message := parseWordFilter(c)
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, message)
+		return
+	}
+	words := []Word{}
+	for _, idx := range filterWords(vocabulary, filter) {
+		words = append(words, vocabulary[idx])
+	}
+
+	buffer := new(bytes.Buffer)
+	if format == "apkg" {
+		deckName := "Vocabulary"
+		if idx, ok := findDeck(filter.Deck); ok {
+			deckName = decks[idx].Name
+		}
+		if err := exportAnkiPackage(buffer, words, deckName, time.Now()); err != nil {
+			log.Printf("Failed to export Anki package: %s", err)
+			respondProblem(c, http.StatusInternalServerError, ErrInternal, "failed to export words")
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=\"vocabulary.apkg\"")
+		c.Data(http.StatusOK, APKG_CONTENT_TYPE, buffer.Bytes())
+		return
+	}
+	if err := exportWords(buffer, words, separator); err != nil {
+		log.Printf("Failed to export words: %s", err)
+		respondProblem(c, http.StatusInternalServerError, ErrInternal, "failed to export words")
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=\"vocabulary."+format+"\"")
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", buffer.Bytes())
+}
+
+// importData reads the format (csv, tsv, quizlet or apkg) from the "format"
+// parameter or the content type. The parameters "column" (repeated, e.g.
+// "vocabulary=Wort"), "duplicates" (skip, update or create), "deck" and
+// "dryRun" control the import. Quizlet exports use the separators given in
+// "termSeparator" and "cardSeparator", Anki packages map the note fields by
+// name like columns.
+func importData(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		switch c.ContentType() {
+		case TSV_CONTENT_TYPE:
+			format = "tsv"
+		case APKG_CONTENT_TYPE, "application/zip":
+			format = "apkg"
+		default:
+			format = "csv"
+		}
+	}
+	separator, _, ok := separatorFor(format)
+	if !ok && format != "quizlet" && format != "apkg" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "format must be csv, tsv, quizlet or apkg")
+		return
+	}
+	mapping, message := parseColumnMapping(c.QueryArray("column"))
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, message)
+		return
+	}
+	options := ImportOptions{Duplicates: DuplicateMode(c.DefaultQuery("duplicates", string(DuplicateSkip)))}
+	switch options.Duplicates {
+	case DuplicateSkip, DuplicateUpdate, DuplicateCreate:
+	default:
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "duplicates must be skip, update or create")
+		return
+	}
+	if options.Deck, ok = deckFilter(c); !ok {
+		respondProblem(c, http.StatusBadRequest, ErrDeckNotFound, "given deck does not exist")
+		return
+	}
+	options.DryRun, _ = strconv.ParseBool(c.Query("dryRun"))
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondBindError(c, err, "failed to read file")
+		return
+	}
+	var lines []importLine
+	media := map[string]importMedia{}
+	switch format {
+	case "apkg":
+		lines, media, message = readAnkiPackage(body, mapping, userFromContext(c), maxBatchSize)
+	case "quizlet":
+		lines, message = readQuizlet(string(body), c.DefaultQuery("termSeparator", "tab"), c.DefaultQuery("cardSeparator", "newline"))
+	default:
+		lines, message = readImport(bytes.NewReader(body), separator, mapping)
+	}
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrMalformedBody, message)
+		return
+	}
+	if len(lines) > maxBatchSize {
+		respondValidationProblem(c, []FieldError{{"", "at most " + strconv.Itoa(maxBatchSize) + " lines are allowed"}})
+		return
+	}
+
+	known, lastID := len(decks), lastDeckID
+	resolveImportDecks(lines, options)
+	updated, report := applyImport(vocabulary, lines, options, time.Now())
+	if options.DryRun || report.Added+report.Updated == 0 {
+		decks, lastDeckID = decks[:known], lastID
+		respond(c, http.StatusOK, report)
+		return
+	}
+
+	vocabulary = updated
+	stored := storeImportMedia(media)
+	applyImportProgress(lines, report, userFromContext(c))
+	saveVocabularyV2(&vocabulary)
+	if keepImportDecks(known, vocabulary) {
+		saveDecks(decks)
+	}
+	cleanupMedia(stored...)
+	rebuildSearchIndex()
+	log.Printf("Imported %d new and %d updated words", report.Added, report.Updated)
+	respond(c, http.StatusOK, report)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	decks = []Deck{}
+	words := []Word{
+		{Vocabulary: "der Hund", Translation: "dog; hound", Tags: []string{"animal", "a1"}, Notes: "barks, \"loudly\""},
+		{Vocabulary: "die Katze", Translation: "cat", Synonyms: []string{"Mieze"}},
+		{Vocabulary: "-chen", Translation: "=HYPERLINK(\"http://example.com\")", Notes: "'=1+1", Tags: []string{"@suffix"}},
+	}
+	for _, separator := range []rune{',', '\t'} {
+		buffer := new(bytes.Buffer)
+		if err := exportWords(buffer, words, separator); err != nil {
+			t.FailNow()
+		}
+		// Spreadsheet programs must not evaluate any cell as formula
+		reader := csv.NewReader(bytes.NewReader(buffer.Bytes()))
+		reader.Comma = separator
+		reader.LazyQuotes = true
+		records, _ := reader.ReadAll()
+		for _, record := range records {
+			for _, cell := range record {
+				if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+					log.Printf("Formula %q not escaped", cell)
+					t.Fail()
+				}
+			}
+		}
+		lines, message := readImport(buffer, separator, map[string]string{})
+		if message != "" || len(lines) != 3 {
+			log.Printf("Failed to read export: %s %d", message, len(lines))
+			t.FailNow()
+		}
+		imported, report := applyImport([]Word{}, lines, ImportOptions{Duplicates: DuplicateSkip, Deck: -1}, time.Now())
+		if report.Added != 3 || len(imported) != 3 {
+			log.Printf("Import incomplete: %+v", report)
+			t.FailNow()
+		}
+		first := imported[0]
+		if first.Translation != "dog; hound" || first.Notes != "barks, \"loudly\"" || len(first.Tags) != 2 || first.UUID == "" {
+			log.Printf("Word changed during round trip: %+v", first)
+			t.FailNow()
+		}
+		if len(imported[1].Synonyms) != 1 || imported[1].Synonyms[0] != "Mieze" {
+			log.Printf("Synonyms lost: %+v", imported[1])
+			t.FailNow()
+		}
+		if last := imported[2]; last.Vocabulary != "-chen" || last.Translation != words[2].Translation || last.Notes != "'=1+1" || last.Tags[0] != "@suffix" {
+			log.Printf("Escaped cells changed: %+v", last)
+			t.FailNow()
+		}
+	}
+}
+
+func TestImportMappingAndDuplicates(t *testing.T) {
+	decks = []Deck{}
+	file := "\ufeffWort;Bedeutung;Schlagworte\n"
+	file = strings.ReplaceAll(file, ";", "\t") +
+		"der Hund\tdog\tanimal\n" +
+		"das Pferd\thorse\t\n" +
+		"der Vogel\t\t\n"
+	mapping, message := parseColumnMapping([]string{"vocabulary=wort", "Translation=Bedeutung", "tags=Schlagworte"})
+	if message != "" {
+		t.FailNow()
+	}
+	lines, message := readImport(strings.NewReader(file), '\t', mapping)
+	if message != "" || len(lines) != 3 || lines[2].line != 4 {
+		log.Printf("Failed to read mapped file: %s %+v", message, lines)
+		t.FailNow()
+	}
+
+	existing := []Word{{UUID: "a", Vocabulary: "Der Hund", Translation: "hound", Tags: []string{"pet"}}}
+	cases := []struct {
+		mode    DuplicateMode
+		added   int
+		updated int
+		skipped int
+	}{
+		{DuplicateSkip, 1, 0, 1},
+		{DuplicateUpdate, 1, 1, 0},
+		{DuplicateCreate, 2, 0, 0},
+	}
+	for _, test := range cases {
+		result, report := applyImport(existing, lines, ImportOptions{Duplicates: test.mode, Deck: -1, DryRun: true}, time.Now())
+		if report.Added != test.added || report.Updated != test.updated || report.Skipped != test.skipped || report.Invalid != 1 {
+			log.Printf("Mode %s: unexpected report %+v", test.mode, report)
+			t.Fail()
+			continue
+		}
+		if report.Rows[2].Action != ImportInvalid || report.Rows[2].Errors[0].Field != "/Translation" {
+			log.Printf("Mode %s: invalid line not reported: %+v", test.mode, report.Rows[2])
+			t.Fail()
+		}
+		if test.mode == DuplicateUpdate && (result[0].Translation != "dog" || len(result[0].Tags) != 2) {
+			log.Printf("Duplicate not updated: %+v", result[0])
+			t.Fail()
+		}
+	}
+	if existing[0].Translation != "hound" {
+		log.Print("Import modified the original words")
+		t.Fail()
+	}
+
+	if _, message := readImport(strings.NewReader("Wort,Meaning\n"), ',', map[string]string{"vocabulary": "Wort"}); message == "" {
+		log.Print("Missing translation column accepted")
+		t.Fail()
+	}
+	if _, message := parseColumnMapping([]string{"colour=Farbe"}); message == "" {
+		log.Print("Unknown field accepted in mapping")
+		t.Fail()
+	}
+}
+
+func TestReadQuizlet(t *testing.T) {
+	lines, message := readQuizlet("\ufeffder Hund\tdog\r\ndie Katze\tcat\n\nder Vogel\n", "tab", "newline")
+	if message != "" || len(lines) != 3 || lines[2].line != 4 {
+		log.Printf("Failed to read Quizlet export: %s %+v", message, lines)
+		t.FailNow()
+	}
+	imported, report := applyImport([]Word{}, lines, ImportOptions{Duplicates: DuplicateSkip, Deck: -1, DryRun: true}, time.Now())
+	if report.Added != 2 || report.Invalid != 1 || imported[1].Translation != "cat" {
+		log.Printf("Unexpected Quizlet import: %+v", report)
+		t.Fail()
+	}
+
+	lines, message = readQuizlet("Hund - dog;Katze - cat", " - ", "semicolon")
+	if message != "" || len(lines) != 2 {
+		log.Printf("Custom separators not applied: %s %d", message, len(lines))
+		t.Fail()
+	}
+	if _, message := readQuizlet("a,b", "comma", ","); message == "" {
+		log.Print("Equal separators accepted")
+		t.Fail()
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CONFIDENCE_BUCKET_SIZE = 20
+	HEATMAP_DAYS           = 365
+	FORECAST_DAYS          = 30
+)
+
+var retentionWindows = []int{7, 30, 365}
+
+type Statistics struct {
+	TotalWords       int
+	ConfidenceBucket map[string]int
+	Retention        map[string]float64 // window -> share of successful reviews
+	CurrentStreak    int
+	LongestStreak    int
+	ReviewsPerDay    map[string]int // date -> number of answers
+	DueForecast      []int          // due words per day, index 0 includes overdue words
+}
+
+func dayKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func confidenceBucket(confidence int) string {
+	if confidence < 0 {
+		confidence = 0
+	}
+	lower := confidence / CONFIDENCE_BUCKET_SIZE * CONFIDENCE_BUCKET_SIZE
+	return fmt.Sprintf("%d-%d", lower, lower+CONFIDENCE_BUCKET_SIZE-1)
+}
+
+// retentionRate returns the share of passed reviews since the given time.
+// The first review of a word is a learning step and does not count towards
+// the retention, which is why the whole history is needed here.
+func retentionRate(history []ReviewEvent, since time.Time) float64 {
+	seen := map[string]bool{}
+	passed, total := 0, 0
+	for _, event := range history {
+		if !event.Grade.valid() {
+			continue
+		}
+		first := !seen[event.WordUUID]
+		seen[event.WordUUID] = true
+		if first || event.Time.Before(since) {
+			continue
+		}
+		total += 1
+		if event.Grade != GradeAgain {
+			passed += 1
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(passed) / float64(total)
+}
+
+// streaks returns the current and the longest run of consecutive days with
+// at least one review. A streak stays current until a full day was missed.
+func streaks(days map[string]int, now time.Time) (int, int) {
+	current, longest := 0, 0
+	if len(days) == 0 {
+		return current, longest
+	}
+	var first time.Time
+	for key := range days {
+		day, err := time.ParseInLocation("2006-01-02", key, now.Location())
+		if err == nil && (first.IsZero() || day.Before(first)) {
+			first = day
+		}
+	}
+	run := 0
+	today := startOfDay(now)
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if days[dayKey(day)] > 0 {
+			run += 1
+		} else if !day.Equal(today) {
+			run = 0
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	current = run
+	return current, longest
+}
+
+func computeStatistics(words []Word, history []ReviewEvent, user string, now time.Time) Statistics {
+	stats := Statistics{
+		TotalWords:       len(words),
+		ConfidenceBucket: map[string]int{},
+		Retention:        map[string]float64{},
+		ReviewsPerDay:    map[string]int{},
+		DueForecast:      make([]int, FORECAST_DAYS),
+	}
+	for _, word := range words {
+		stats.ConfidenceBucket[confidenceBucket(word.Confidence)] += 1
+	}
+
+	userHistory := []ReviewEvent{}
+	for _, event := range history {
+		if event.User == user {
+			userHistory = append(userHistory, event)
+		}
+	}
+	sort.SliceStable(userHistory, func(i, j int) bool {
+		return userHistory[i].Time.Before(userHistory[j].Time)
+	})
+	allDays := map[string]int{}
+	heatmapStart := startOfDay(now).AddDate(0, 0, -HEATMAP_DAYS+1)
+	for _, event := range userHistory {
+		local := event.Time.In(now.Location())
+		allDays[dayKey(local)] += 1
+		if !local.Before(heatmapStart) {
+			stats.ReviewsPerDay[dayKey(local)] += 1
+		}
+	}
+	stats.CurrentStreak, stats.LongestStreak = streaks(allDays, now)
+
+	for _, window := range retentionWindows {
+		since := now.AddDate(0, 0, -window)
+		stats.Retention[fmt.Sprintf("%dd", window)] = retentionRate(userHistory, since)
+	}
+
+	today := startOfDay(now)
+	for _, word := range words {
+		if word.Schedule.Due.IsZero() {
+			continue
+		}
+		day := int(math.Round(startOfDay(word.Schedule.Due.In(now.Location())).Sub(today).Hours() / 24))
+		if day < 0 {
+			day = 0
+		}
+		if day < FORECAST_DAYS {
+			stats.DueForecast[day] += 1
+		}
+	}
+	return stats
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getStatistics(c *gin.Context) {
+	stats := computeStatistics(vocabulary, reviewHistory, userFromContext(c), time.Now())
+	respond(c, http.StatusOK, stats)
+}
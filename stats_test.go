@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"testing"
+	"time"
+)
+
+func TestStatistics(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := func(offset int) time.Time {
+		return now.AddDate(0, 0, offset)
+	}
+	words := []Word{
+		{UUID: "a", Confidence: 5, Schedule: Schedule{Due: day(-2)}},
+		{UUID: "b", Confidence: 45, Schedule: Schedule{Due: day(3)}},
+		{UUID: "c", Confidence: 47, Schedule: Schedule{Due: day(40)}},
+		{UUID: "d", Confidence: 100},
+	}
+	history := []ReviewEvent{
+		// Longest streak of three days
+		{WordUUID: "a", User: "lerner", Time: day(-10), Grade: GradeGood},
+		{WordUUID: "a", User: "lerner", Time: day(-9), Grade: GradeAgain},
+		{WordUUID: "b", User: "lerner", Time: day(-8), Grade: GradeGood},
+		// Current streak of two days
+		{WordUUID: "b", User: "lerner", Time: day(-1), Grade: GradeGood},
+		{WordUUID: "a", User: "lerner", Time: day(0), Grade: GradeHard},
+		{WordUUID: "c", User: "lerner", Time: day(0), Confidence: 20},
+		{WordUUID: "c", User: "other", Time: day(-3), Grade: GradeGood},
+	}
+	stats := computeStatistics(words, history, "lerner", now)
+
+	if stats.TotalWords != 4 || stats.ConfidenceBucket["40-59"] != 2 || stats.ConfidenceBucket["100-119"] != 1 {
+		log.Printf("Unexpected word counts: %+v", stats)
+		t.FailNow()
+	}
+	if stats.CurrentStreak != 2 || stats.LongestStreak != 3 {
+		log.Printf("Unexpected streaks: %d %d", stats.CurrentStreak, stats.LongestStreak)
+		t.FailNow()
+	}
+	// Within the last week only two non-first reviews exist, both passed
+	if stats.Retention["7d"] != 1 || stats.Retention["30d"] != 2.0/3.0 {
+		log.Printf("Unexpected retention: %+v", stats.Retention)
+		t.FailNow()
+	}
+	if stats.ReviewsPerDay["2024-03-10"] != 2 || stats.ReviewsPerDay["2024-03-07"] != 0 {
+		log.Printf("Unexpected heatmap: %+v", stats.ReviewsPerDay)
+		t.FailNow()
+	}
+	if stats.DueForecast[0] != 1 || stats.DueForecast[3] != 1 || len(stats.DueForecast) != FORECAST_DAYS {
+		log.Printf("Unexpected forecast: %+v", stats.DueForecast)
+		t.FailNow()
+	}
+}
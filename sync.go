@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SYNC_FILE = "sync.json"
+	// Clients which did not synchronize for longer have to start over
+	TOMBSTONE_RETENTION = 90 * 24 * time.Hour
+	MAX_SYNC_CHANGES    = 1000
+)
+
+// Tombstone remembers a removed word, so clients synchronizing later remove
+// it as well.
+type Tombstone struct {
+	UUID     string
+	Sequence int
+	Deleted  time.Time
+}
+
+// SyncState is the change sequence of the vocabulary. Every change of a word
+// takes the next number, the change token handed to clients is the number of
+// the last change they have seen. Tokens below Floor may miss deletions,
+// since the tombstones were pruned.
+type SyncState struct {
+	Sequence   int
+	Floor      int
+	Tombstones []Tombstone
+}
+
+var syncState = SyncState{Tombstones: []Tombstone{}}
+
+// SyncChanges answers GET /sync. Token is passed as "since" on the next call,
+// if More is set there are further changes after it.
+type SyncChanges struct {
+	Token   string
+	More    bool
+	Words   []Word
+	Deleted []Tombstone
+}
+
+// SyncChange is a change made by a client, possibly while it was offline.
+// Creates may bring the UUID the client assigned, updates and deletes name
+// the revision the change is based on. Updates of an older revision are
+// merged field by field, Clock is the time of the change on the device and
+// Policy how concurrent writes of a field are resolved (see conflict.go).
+// Reviews are appended to the history and never conflict.
+type SyncChange struct {
+	Op       BatchOp
+	UUID     string
+	Revision int
+	Word     json.RawMessage
+	Clock    *HLC
+	Policy   ConflictPolicy
+	Review   *OfflineReview
+}
+
+// OfflineReview is a review with the time it was actually given
+type OfflineReview struct {
+	WordReview
+	Time time.Time
+}
+
+// SyncResult reports the outcome of the change at the same position. On
+// conflicts Word is the current version of the server and the errors of the
+// problem name the conflicting fields. Discarded are the fields of the
+// change that lost against a later write on another device.
+type SyncResult struct {
+	Op        BatchOp
+	UUID      string
+	Status    int
+	Word      *Word
+	Error     *Problem
+	Discarded []string
+}
+
+func readSyncState() SyncState {
+	log.Print("Reading existing change sequence")
+	content, err := os.ReadFile(SYNC_FILE)
+	if err != nil || string(content) == "" {
+		log.Print("No change sequence found. Creating new one...")
+		return SyncState{Tombstones: []Tombstone{}}
+	}
+	var state SyncState
+	if err := json.Unmarshal(content, &state); err != nil {
+		log.Print("The given file does not contain a valid change sequence!")
+		return SyncState{Tombstones: []Tombstone{}}
+	}
+	if state.Tombstones == nil {
+		state.Tombstones = []Tombstone{}
+	}
+	return state
+}
+
+// saveSyncState prunes old tombstones and stores the change sequence
+func saveSyncState() {
+	limit := time.Now().Add(-TOMBSTONE_RETENTION)
+	kept := make([]Tombstone, 0, len(syncState.Tombstones))
+	for _, tombstone := range syncState.Tombstones {
+		if tombstone.Deleted.Before(limit) {
+			if tombstone.Sequence > syncState.Floor {
+				syncState.Floor = tombstone.Sequence
+			}
+			continue
+		}
+		kept = append(kept, tombstone)
+	}
+	syncState.Tombstones = kept
+
+	rawData, err := json.MarshalIndent(syncState, "", "\t")
+	if err != nil {
+		log.Print("Failed to convert change sequence to JSON!")
+		return
+	}
+	if err := os.WriteFile(SYNC_FILE, rawData, 0644); err != nil {
+		log.Printf("Failed to write file \"%s\"", SYNC_FILE)
+	}
+}
+
+func nextSequence() int {
+	syncState.Sequence += 1
+	return syncState.Sequence
+}
+
+func recordTombstone(uuid string, now time.Time) {
+	syncState.Tombstones = append(syncState.Tombstones, Tombstone{UUID: uuid, Sequence: nextSequence(), Deleted: now})
+}
+
+// forgetTombstones removes the tombstones of words that exist again
+func forgetTombstones(uuids []string) {
+	if len(uuids) == 0 || len(syncState.Tombstones) == 0 {
+		return
+	}
+	existing := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		existing[uuid] = true
+	}
+	kept := syncState.Tombstones[:0]
+	for _, tombstone := range syncState.Tombstones {
+		if !existing[tombstone.UUID] {
+			kept = append(kept, tombstone)
+		}
+	}
+	syncState.Tombstones = kept
+}
+
+func isTombstoned(uuid string) bool {
+	for _, tombstone := range syncState.Tombstones {
+		if tombstone.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// expireSyncTokens forces all clients into a full synchronization, e.g.
+// after the vocabulary was replaced
+func expireSyncTokens() {
+	syncState.Floor = nextSequence()
+	syncState.Tombstones = []Tombstone{}
+	saveSyncState()
+}
+
+// parseSyncToken returns the sequence number of a token. An empty token
+// requests everything.
+func parseSyncToken(token string) (int, *Problem) {
+	if token == "" {
+		return 0, nil
+	}
+	since, err := strconv.Atoi(token)
+	if err != nil || since < 0 {
+		return 0, newProblem(http.StatusBadRequest, ErrInvalidParameter, "invalid change token")
+	}
+	if since > syncState.Sequence || (since > 0 && since < syncState.Floor) {
+		return 0, newProblem(http.StatusGone, ErrSyncTokenExpired, "change token expired, synchronize without token")
+	}
+	return since, nil
+}
+
+// collectChanges returns the words and tombstones changed after the given
+// sequence number in the order of the changes, at most limit of them. A full
+// synchronization contains no tombstones.
+func collectChanges(words []Word, since int, limit int) SyncChanges {
+	type change struct {
+		sequence int
+		word     int
+		deleted  int
+	}
+	changes := []change{}
+	for idx := range words {
+		if words[idx].Sequence > since {
+			changes = append(changes, change{words[idx].Sequence, idx, -1})
+		}
+	}
+	if since > 0 {
+		for idx, tombstone := range syncState.Tombstones {
+			if tombstone.Sequence > since {
+				changes = append(changes, change{tombstone.Sequence, -1, idx})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].sequence < changes[j].sequence
+	})
+
+	result := SyncChanges{Token: strconv.Itoa(syncState.Sequence), Words: []Word{}, Deleted: []Tombstone{}}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		result.More = true
+		result.Token = strconv.Itoa(changes[limit-1].sequence)
+	}
+	for _, change := range changes {
+		if change.word >= 0 {
+			result.Words = append(result.Words, words[change.word])
+		} else {
+			result.Deleted = append(result.Deleted, syncState.Tombstones[change.deleted])
+		}
+	}
+	return result
+}
+
+// syncOperation converts an update or delete into the batch operation
+func syncOperation(change SyncChange) BatchOperation {
+	operation := BatchOperation{Op: change.Op, UUID: change.UUID, Word: change.Word}
+	if change.Revision > 0 {
+		operation.IfMatch = wordETag(Word{UUID: change.UUID, Revision: change.Revision})
+	}
+	return operation
+}
+
+func syncProblem(result SyncResult, status int, code ErrorCode, detail string) SyncResult {
+	result.Status = status
+	result.Error = newProblem(status, code, detail)
+	return result
+}
+
+// syncConflict reports a change based on an outdated revision together with
+// the current version, so the client can resolve the conflict.
+func syncConflict(result SyncResult, current Word) SyncResult {
+	result = syncProblem(result, http.StatusConflict, ErrEditConflict, "word was modified on another device")
+	result.Word = &current
+	return result
+}
+
+// sameContent checks whether a word created by a client equals the stored one
+func sameContent(stored Word, raw json.RawMessage) bool {
+	var word Word
+	if err := json.Unmarshal(raw, &word); err != nil {
+		return false
+	}
+	restoreLearningState(&word, stored)
+	normalizeWord(&word)
+	return wordFingerprint(word) == wordFingerprint(stored)
+}
+
+// applySyncReview records a review given offline like a review made on the
+// server. Reviews already recorded are ignored, so clients can resend them.
+func applySyncReview(words []Word, idx int, review OfflineReview, user string, now time.Time) (bool, string) {
+	if !review.Grade.valid() {
+		return false, "grade out of range"
+	}
+	if review.Direction == "" {
+		review.Direction = DirectionForward
+	}
+	if !review.Direction.valid() {
+		return false, "unknown direction"
+	}
+	if review.Time.IsZero() || review.Time.After(now) {
+		review.Time = now
+	}
+	for _, event := range reviewHistory {
+		if event.WordUUID == words[idx].UUID && event.Time.Equal(review.Time) {
+			return true, ""
+		}
+	}
+	applyReview(&words[idx], review.WordReview, user, review.Time)
+	return true, ""
+}
+
+// applySyncChange applies a single change of a client. Unlike batches every
+// change succeeds or fails on its own.
+func applySyncChange(words []Word, change SyncChange, allowDuplicates bool, user string, now time.Time) ([]Word, SyncResult) {
+	result := SyncResult{Op: change.Op, UUID: change.UUID, Discarded: []string{}}
+	idx := -1
+	if change.UUID != "" {
+		idx = indexOfUUID(words, change.UUID)
+	}
+	if idx < 0 && change.UUID != "" && isTombstoned(change.UUID) {
+		if change.Op == BatchDelete {
+			result.Status = http.StatusNoContent
+			return words, result
+		}
+		return words, syncProblem(result, http.StatusGone, ErrWordRemoved, "word was removed on another device")
+	}
+
+	var batchResult BatchResult
+	switch change.Op {
+	case BatchCreate:
+		if idx >= 0 {
+			// A create sent again because the response got lost
+			if sameContent(words[idx], change.Word) {
+				result.Status = http.StatusOK
+				return words, result
+			}
+			existing := words[idx]
+			result = syncProblem(result, http.StatusConflict, ErrWordExists, "word already exists")
+			result.Word = &existing
+			return words, result
+		}
+		if change.UUID != "" && !uuidPattern.MatchString(change.UUID) {
+			return words, syncProblem(result, http.StatusBadRequest, ErrInvalidRequest, "invalid UUID")
+		}
+		words, batchResult = applyBatchOperation(words, words, BatchOperation{Op: BatchCreate, Word: change.Word}, allowDuplicates, now)
+		if batchResult.Error == nil {
+			if change.UUID != "" {
+				words[len(words)-1].UUID = change.UUID
+			}
+			result.UUID = words[len(words)-1].UUID
+		}
+	case BatchUpdate:
+		policy := change.Policy
+		if policy == "" {
+			policy = PolicyLastWriter
+		}
+		if !policy.valid() {
+			return words, syncProblem(result, http.StatusBadRequest, ErrInvalidRequest, "unknown policy "+string(policy))
+		}
+		clock := change.Clock
+		if clock != nil && clockSkewed(*clock, now) {
+			log.Printf("Ignoring clock of %s, it is ahead of the server", clock.Node)
+			clock = nil
+		}
+		var original Word
+		if idx >= 0 {
+			original = words[idx]
+		}
+		if idx >= 0 && change.Revision > 0 && change.Revision != words[idx].Revision {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(change.Word, &fields); err != nil {
+				return words, syncProblem(result, http.StatusBadRequest, ErrMalformedBody, "word is in incorrect format")
+			}
+			apply, discarded, conflicts := mergeFields(words[idx], change.Revision, fields, clock, policy)
+			if len(conflicts) > 0 {
+				result = syncConflict(result, words[idx])
+				result.Error.Errors = conflicts
+				return words, result
+			}
+			result.Discarded = discarded
+			change.Word, _ = json.Marshal(apply)
+			change.Revision = words[idx].Revision
+		}
+		words, batchResult = applyBatchOperation(words, words, syncOperation(change), false, now)
+		if batchResult.Error == nil && clock != nil {
+			serverClock.observe(*clock, now)
+			stampClientVersions(&words[idx], original, *clock)
+		}
+	case BatchDelete:
+		// Removing a word changed in the meantime would lose the changes
+		if idx >= 0 && change.Revision > 0 && change.Revision != words[idx].Revision {
+			return words, syncConflict(result, words[idx])
+		}
+		words, batchResult = applyBatchOperation(words, words, syncOperation(change), false, now)
+	case BatchReview:
+		if idx < 0 {
+			return words, syncProblem(result, http.StatusNotFound, ErrWordNotFound, "word not found")
+		}
+		if change.Review == nil {
+			return words, syncProblem(result, http.StatusBadRequest, ErrInvalidRequest, "Review is missing")
+		}
+		if ok, message := applySyncReview(words, idx, *change.Review, user, now); !ok {
+			return words, syncProblem(result, http.StatusBadRequest, ErrInvalidRequest, message)
+		}
+		result.Status = http.StatusOK
+		return words, result
+	default:
+		return words, syncProblem(result, http.StatusBadRequest, ErrInvalidRequest, "unknown operation "+string(change.Op))
+	}
+	if batchResult.Error != nil && batchResult.Error.Code == ErrPreconditionRequired {
+		batchResult.Error.Detail = "Revision is missing"
+	}
+	result.Status = batchResult.Status
+	result.Error = batchResult.Error
+	if change.Op == BatchDelete && batchResult.Error == nil {
+		// Kept until the media of the word is cleaned up
+		result.Word = batchResult.Word
+	}
+	return words, result
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+// getChanges returns the words changed and removed since the change token in
+// "since". Without token all words are returned.
+func getChanges(c *gin.Context) {
+	since, problem := parseSyncToken(c.Query("since"))
+	if problem != nil {
+		writeProblem(c, problem)
+		return
+	}
+	limit := MAX_SYNC_CHANGES
+	if param, ok := c.GetQuery("limit"); ok {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 || parsed > MAX_SYNC_CHANGES {
+			respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, "limit out of range")
+			return
+		}
+		limit = parsed
+	}
+	respond(c, http.StatusOK, collectChanges(vocabulary, since, limit))
+}
+
+// postChanges applies the changes a client collected while offline and
+// reports the result of every change.
+func postChanges(c *gin.Context) {
+	var changes []SyncChange
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		log.Printf("Changes are in incorrect format: %s", err)
+		respondBindError(c, err, "changes are in incorrect format")
+		return
+	}
+	if len(changes) > maxBatchSize {
+		respondValidationProblem(c, []FieldError{{"", "at most " + strconv.Itoa(maxBatchSize) + " changes are allowed"}})
+		return
+	}
+
+	if len(changes) == 0 {
+		respond(c, http.StatusOK, []SyncResult{})
+		return
+	}
+
+	user := userFromContext(c)
+	allowDuplicates := c.Query("allowDuplicate") == "true"
+	now := time.Now()
+	results := make([]SyncResult, len(changes))
+	for idx, change := range changes {
+		vocabulary, results[idx] = applySyncChange(vocabulary, change, allowDuplicates, user, now)
+	}
+	// Clients resend rejected changes, which must not rewrite the file
+	applied := false
+	for _, result := range results {
+		applied = applied || result.Error == nil
+	}
+	if !applied {
+		respond(c, http.StatusOK, results)
+		return
+	}
+	saveVocabularyV2(&vocabulary)
+
+	for idx := range results {
+		if results[idx].Error != nil {
+			continue
+		}
+		if results[idx].Op == BatchDelete {
+			if word := results[idx].Word; word != nil {
+				searchIndex.remove(word.UUID)
+				cleanupMedia(word.Audio, word.Image)
+			}
+			results[idx].Word = nil
+			continue
+		}
+		// Report the stored state, including the final index and revision
+		if pos := indexOfUUID(vocabulary, results[idx].UUID); pos >= 0 {
+			stored := vocabulary[pos]
+			results[idx].Word = &stored
+			searchIndex.add(stored)
+		}
+	}
+	log.Printf("Synchronized %d changes", len(changes))
+	respond(c, http.StatusOK, results)
+}
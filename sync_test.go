@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func syncTestWords(t *testing.T) []Word {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	wordFingerprints = map[string][32]byte{}
+	fieldFingerprints = map[string]map[string]uint64{}
+	syncState = SyncState{Tombstones: []Tombstone{}}
+	reviewHistory = []ReviewEvent{}
+	decks = []Deck{}
+	words := []Word{
+		{UUID: "hund", Vocabulary: "der Hund", Translation: "dog"},
+		{UUID: "katze", Vocabulary: "die Katze", Translation: "cat"},
+		{UUID: "maus", Vocabulary: "die Maus", Translation: "mouse"},
+	}
+	for idx := range words {
+		normalizeWord(&words[idx])
+	}
+	stampRevisions(words)
+	return words
+}
+
+func TestChangeSequence(t *testing.T) {
+	words := syncTestWords(t)
+	if words[0].Sequence != 1 || words[2].Sequence != 3 || syncState.Sequence != 3 {
+		log.Printf("Unexpected sequence: %+v", words)
+		t.FailNow()
+	}
+
+	words[1].Translation = "kitten"
+	words = append(words[:2:2], Word{UUID: "vogel", Vocabulary: "der Vogel", Translation: "bird"})
+	stampRevisions(words)
+	changes := collectChanges(words, 3, MAX_SYNC_CHANGES)
+	if changes.Token != "6" || len(changes.Words) != 2 || len(changes.Deleted) != 1 || changes.Deleted[0].UUID != "maus" {
+		log.Printf("Unexpected changes: %+v", changes)
+		t.FailNow()
+	}
+
+	// Paging continues after the last change returned
+	changes = collectChanges(words, 3, 2)
+	if !changes.More || changes.Token != "5" || len(changes.Words) != 2 || len(changes.Deleted) != 0 {
+		log.Printf("Unexpected first page: %+v", changes)
+		t.FailNow()
+	}
+	changes = collectChanges(words, 5, 2)
+	if changes.More || changes.Token != "6" || len(changes.Words) != 0 || len(changes.Deleted) != 1 {
+		log.Printf("Unexpected second page: %+v", changes)
+		t.FailNow()
+	}
+
+	// A full synchronization needs no tombstones
+	if changes := collectChanges(words, 0, MAX_SYNC_CHANGES); len(changes.Words) != 3 || len(changes.Deleted) != 0 {
+		log.Printf("Unexpected full synchronization: %+v", changes)
+		t.Fail()
+	}
+}
+
+func TestParseSyncToken(t *testing.T) {
+	syncTestWords(t)
+	syncState.Floor = 2
+	cases := []struct {
+		token  string
+		status int
+	}{
+		{"", 0},
+		{"0", 0},
+		{"2", 0},
+		{"3", 0},
+		{"1", http.StatusGone},
+		{"4", http.StatusGone},
+		{"abc", http.StatusBadRequest},
+	}
+	for _, test := range cases {
+		_, problem := parseSyncToken(test.token)
+		if (problem == nil) != (test.status == 0) || (problem != nil && problem.Status != test.status) {
+			log.Printf("Token %q: expected %d got %+v", test.token, test.status, problem)
+			t.Fail()
+		}
+	}
+}
+
+func TestApplySyncChange(t *testing.T) {
+	words := syncTestWords(t)
+	now := time.Now()
+	review := &OfflineReview{WordReview{Grade: GradeGood}, now.Add(-time.Hour)}
+	changes := []SyncChange{
+		{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "hound"}`)},
+		{Op: BatchUpdate, UUID: "hund", Revision: 1, Word: json.RawMessage(`{"Translation": "doggy"}`)},
+		{Op: BatchCreate, UUID: "0f8fad5b-d9cb-469f-a165-70867728950e", Word: json.RawMessage(`{"Vocabulary": "der Fisch", "Translation": "fish"}`)},
+		{Op: BatchCreate, UUID: "0f8fad5b-d9cb-469f-a165-70867728950e", Word: json.RawMessage(`{"Vocabulary": "der Fisch", "Translation": "fish"}`)},
+		{Op: BatchCreate, UUID: "0f8fad5b-d9cb-469f-a165-70867728950e", Word: json.RawMessage(`{"Vocabulary": "der Fisch", "Translation": "trout"}`)},
+		{Op: BatchDelete, UUID: "maus", Revision: 1},
+		{Op: BatchUpdate, UUID: "katze"},
+		{Op: BatchReview, UUID: "katze", Review: review},
+		{Op: BatchReview, UUID: "katze", Review: review},
+	}
+	expected := []int{http.StatusOK, http.StatusConflict, http.StatusCreated, http.StatusOK, http.StatusConflict, http.StatusNoContent, http.StatusPreconditionRequired, http.StatusOK, http.StatusOK}
+	for idx, change := range changes {
+		var result SyncResult
+		words, result = applySyncChange(words, change, false, "", now)
+		if result.Status != expected[idx] {
+			log.Printf("Change %d: expected %d got %+v", idx, expected[idx], result)
+			t.Fail()
+		}
+		// Revisions are assigned when storing
+		stampRevisions(words)
+	}
+	if len(words) != 3 || words[0].Translation != "hound" || words[2].UUID != "0f8fad5b-d9cb-469f-a165-70867728950e" {
+		log.Printf("Unexpected words: %+v", words)
+		t.FailNow()
+	}
+	if len(reviewHistory) != 1 || words[1].Schedule.Repetitions != 1 {
+		log.Printf("Review not recorded once: %d %+v", len(reviewHistory), words[1].Schedule)
+		t.Fail()
+	}
+	// Synchronized reviews change the confidence like reviews on the server
+	if words[1].Confidence == 0 || words[1].Confidence != reviewHistory[0].Confidence {
+		log.Printf("Confidence not updated by the review: %+v", words[1])
+		t.Fail()
+	}
+	if _, result := applySyncChange(words, SyncChange{Op: BatchCreate, UUID: "client-1", Word: json.RawMessage(`{"Vocabulary": "der Wal", "Translation": "whale"}`)}, false, "", now); result.Status != http.StatusBadRequest {
+		log.Printf("Invalid UUID accepted: %+v", result)
+		t.Fail()
+	}
+
+	// The word was removed on another device
+	if _, result := applySyncChange(words, SyncChange{Op: BatchDelete, UUID: "maus", Revision: 1}, false, "", now); result.Status != http.StatusNoContent {
+		log.Printf("Repeated delete failed: %+v", result)
+		t.Fail()
+	}
+	if _, result := applySyncChange(words, SyncChange{Op: BatchUpdate, UUID: "maus", Revision: 1}, false, "", now); result.Status != http.StatusGone {
+		log.Printf("Update of removed word: %+v", result)
+		t.Fail()
+	}
+}
+
+func TestPostChangesWithoutChanges(t *testing.T) {
+	vocabulary = syncTestWords(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/sync", postChanges)
+	// Polling clients and resent conflicts must not touch the files
+	for _, body := range []string{`[]`, `[{"Op": "update", "UUID": "hund", "Word": {}}]`} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/sync", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			log.Printf("Sync of %s failed with %d", body, w.Code)
+			t.Fail()
+		}
+	}
+	if files, _ := filepath.Glob("vocabulary*.json"); len(files) != 0 {
+		log.Printf("Files written without changes: %v", files)
+		t.Fail()
+	}
+}
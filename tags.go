@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+type TagOperation struct {
+	Add    []string
+	Remove []string
+}
+
+// normalizeTags lowercases and trims the tags and removes empty entries and
+// duplicates. The result is sorted and never nil.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func hasTag(word Word, tag string) bool {
+	for _, t := range word.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func countTags(words []Word) []TagCount {
+	counts := map[string]int{}
+	for _, word := range words {
+		for _, tag := range word.Tags {
+			counts[tag] += 1
+		}
+	}
+	list := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		list = append(list, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return list
+}
+
+func applyTagOperation(word *Word, operation TagOperation) {
+	remove := map[string]bool{}
+	for _, tag := range normalizeTags(operation.Remove) {
+		remove[tag] = true
+	}
+	tags := []string{}
+	for _, tag := range append(word.Tags, operation.Add...) {
+		if !remove[strings.ToLower(strings.TrimSpace(tag))] {
+			tags = append(tags, tag)
+		}
+	}
+	word.Tags = normalizeTags(tags)
+}
+
+// -------------------------------------------------------------------------------
+// API Implementation
+// -------------------------------------------------------------------------------
+
+func getTags(c *gin.Context) {
+	respond(c, http.StatusOK, countTags(vocabulary))
+}
+
+func bulkTagWords(c *gin.Context) {
+	filter, message := parseWordFilter(c)
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, message)
+		return
+	}
+	var operation TagOperation
+	if err := c.ShouldBindJSON(&operation); err != nil {
+		log.Printf("Tag operation is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid tag operation")
+		return
+	}
+	matching := filterWords(vocabulary, filter)
+	for _, idx := range matching {
+		applyTagOperation(&vocabulary[idx], operation)
+	}
+	log.Printf("Changed tags of %d words", len(matching))
+	saveVocabularyV2(&vocabulary)
+
+	changed := make([]Word, 0, len(matching))
+	for _, idx := range matching {
+		changed = append(changed, vocabulary[idx])
+	}
+	respond(c, http.StatusOK, changed)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"testing"
+)
+
+var taggedWords = []Word{
+	{Vocabulary: "laufen", Tags: []string{"chapter-3", "verb"}},
+	{Vocabulary: "essen", Tags: []string{"food", "verb"}},
+	{Vocabulary: "der Apfel", Tags: []string{"food"}, Deck: 2},
+	{Vocabulary: "der Tisch"},
+}
+
+func TestFilterWordsByTag(t *testing.T) {
+	cases := []struct {
+		filter   WordFilter
+		expected []int
+	}{
+		{WordFilter{Deck: -1}, []int{0, 1, 2, 3}},
+		{WordFilter{Tags: []string{"verb", "food"}, Deck: -1}, []int{1}},
+		{WordFilter{Tags: []string{"verb", "food"}, MatchAny: true, Deck: -1}, []int{0, 1, 2}},
+		{WordFilter{Tags: []string{"food"}, Deck: 2}, []int{2}},
+		{WordFilter{Tags: []string{"noun"}, MatchAny: true, Deck: -1}, []int{}},
+	}
+	for _, test := range cases {
+		if result := filterWords(taggedWords, test.filter); !reflect.DeepEqual(result, test.expected) {
+			log.Printf("Filter %+v: expected %v got %v", test.filter, test.expected, result)
+			t.Fail()
+		}
+	}
+}
+
+func TestTagOperations(t *testing.T) {
+	word := Word{Tags: []string{"verb", "food"}}
+	applyTagOperation(&word, TagOperation{Add: []string{" Chapter-3", "verb"}, Remove: []string{"FOOD"}})
+	if !reflect.DeepEqual(word.Tags, []string{"chapter-3", "verb"}) {
+		log.Printf("Unexpected tags: %v", word.Tags)
+		t.FailNow()
+	}
+	counts := countTags(taggedWords)
+	expected := []TagCount{{"food", 2}, {"verb", 2}, {"chapter-3", 1}}
+	if !reflect.DeepEqual(counts, expected) {
+		log.Printf("Unexpected tag counts: %v", counts)
+		t.FailNow()
+	}
+	// Words without tags compare equal to words with an empty tag list
+	if !equalWords(Word{Vocabulary: "a"}, Word{Vocabulary: "a", Tags: []string{}}) {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MAX_BODY_SIZE     = 1 << 20
+	MAX_IMPORT_SIZE   = 100 << 20
+	MAX_BATCH_SIZE    = 1000
+	MAX_TEXT_LENGTH   = 200
+	MAX_ANSWER_LENGTH = 500
+	MAX_NOTES_LENGTH  = 2000
+	MAX_LIST_ITEMS    = 50
+	MAX_CONFIDENCE    = 100
+	MAX_REPEAT        = 100000
+)
+
+type IntRange struct {
+	Min int
+	Max int
+}
+
+func between(min int, max int) *IntRange {
+	return &IntRange{Min: min, Max: max}
+}
+
+// FieldRule restricts a single field of a request body. The field is a JSON
+// Pointer, "*" matches every entry of a list or object. Zero values are not
+// checked.
+type FieldRule struct {
+	Field     string
+	Required  bool
+	MaxLength int
+	MaxItems  int
+	Range     *IntRange
+}
+
+// Schema describes the body of a request. List bodies apply the rules to
+// every item and may contain at most MaxItems items.
+type Schema struct {
+	List     bool
+	MaxItems int
+	Rules    []FieldRule
+}
+
+var wordRules = []FieldRule{
+	{Field: "/Vocabulary", Required: true, MaxLength: MAX_TEXT_LENGTH},
+	{Field: "/Translation", Required: true, MaxLength: MAX_ANSWER_LENGTH},
+	{Field: "/Confidence", Range: between(0, MAX_CONFIDENCE)},
+	{Field: "/Repeat", Range: between(0, MAX_REPEAT)},
+	{Field: "/Tags", MaxItems: MAX_LIST_ITEMS},
+	{Field: "/Tags/*", MaxLength: MAX_TEXT_LENGTH},
+	{Field: "/Translations", MaxItems: MAX_LIST_ITEMS},
+	{Field: "/Translations/*", MaxLength: MAX_ANSWER_LENGTH},
+	{Field: "/Article", MaxLength: MAX_TEXT_LENGTH},
+	{Field: "/Plural", MaxLength: MAX_TEXT_LENGTH},
+	{Field: "/Examples", MaxItems: MAX_LIST_ITEMS},
+	{Field: "/Examples/*/Sentence", MaxLength: MAX_ANSWER_LENGTH},
+	{Field: "/Examples/*/Translation", MaxLength: MAX_ANSWER_LENGTH},
+	{Field: "/Notes", MaxLength: MAX_NOTES_LENGTH},
+	{Field: "/Synonyms", MaxItems: MAX_LIST_ITEMS},
+	{Field: "/Synonyms/*", MaxLength: MAX_TEXT_LENGTH},
+	{Field: "/Antonyms", MaxItems: MAX_LIST_ITEMS},
+	{Field: "/Antonyms/*", MaxLength: MAX_TEXT_LENGTH},
+}
+
+var wordSchema = Schema{Rules: wordRules}
+
+var confidenceSchema = Schema{
+	List:     true,
+	MaxItems: MAX_BATCH_SIZE,
+	Rules: []FieldRule{
+		{Field: "/ID", Range: between(0, math.MaxInt32)},
+		{Field: "/UUID", MaxLength: MAX_TEXT_LENGTH},
+		{Field: "/Confidence", Range: between(0, MAX_CONFIDENCE)},
+		{Field: "/Repeat", Range: between(0, MAX_REPEAT)},
+	},
+}
+
+// fieldValue is a value found for a rule. Missing values are reported as
+// well, so required fields can be checked.
+type fieldValue struct {
+	pointer string
+	value   interface{}
+	present bool
+}
+
+// resolveField returns all values matching the path of a rule.
+func resolveField(doc interface{}, path []string, pointer string) []fieldValue {
+	if len(path) == 0 {
+		return []fieldValue{{pointer, doc, true}}
+	}
+	values := []fieldValue{}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			keys := make([]string, 0, len(node))
+			for key := range node {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				values = append(values, resolveField(node[key], path[1:], pointer+"/"+key)...)
+			}
+			return values
+		}
+		key := objectKey(node, path[0])
+		child, ok := node[key]
+		if !ok || child == nil {
+			return []fieldValue{{pointer + "/" + path[0], nil, false}}
+		}
+		return resolveField(child, path[1:], pointer+"/"+path[0])
+	case []interface{}:
+		if path[0] != "*" {
+			return values
+		}
+		for idx, child := range node {
+			values = append(values, resolveField(child, path[1:], pointer+"/"+strconv.Itoa(idx))...)
+		}
+	case nil:
+		return []fieldValue{{pointer + "/" + strings.Join(path, "/"), nil, false}}
+	}
+	return values
+}
+
+func (rule FieldRule) check(field fieldValue) (string, bool) {
+	if !field.present {
+		return "field is required", !rule.Required
+	}
+	switch value := field.value.(type) {
+	case string:
+		if rule.Required && strings.TrimSpace(value) == "" {
+			return "field is required", false
+		}
+		if rule.MaxLength > 0 && utf8.RuneCountInString(value) > rule.MaxLength {
+			return "at most " + strconv.Itoa(rule.MaxLength) + " characters are allowed", false
+		}
+		if rule.Range != nil {
+			return "must be a number", false
+		}
+	case float64:
+		if rule.MaxLength > 0 || rule.MaxItems > 0 {
+			return "must not be a number", false
+		}
+		if rule.Range != nil {
+			if value != math.Trunc(value) {
+				return "must be a whole number", false
+			}
+			if value < float64(rule.Range.Min) || value > float64(rule.Range.Max) {
+				return "must be between " + strconv.Itoa(rule.Range.Min) + " and " + strconv.Itoa(rule.Range.Max), false
+			}
+		}
+	case []interface{}:
+		if rule.MaxItems > 0 && len(value) > rule.MaxItems {
+			return "at most " + strconv.Itoa(rule.MaxItems) + " entries are allowed", false
+		}
+	case map[string]interface{}:
+		if rule.MaxItems > 0 && len(value) > rule.MaxItems {
+			return "at most " + strconv.Itoa(rule.MaxItems) + " entries are allowed", false
+		}
+	default:
+		if rule.Range != nil {
+			return "must be a number", false
+		}
+	}
+	return "", true
+}
+
+func checkRules(doc interface{}, rules []FieldRule, prefix string, partial bool) []FieldError {
+	errors := []FieldError{}
+	for _, rule := range rules {
+		path, _ := parsePointer(rule.Field)
+		for _, field := range resolveField(doc, path, prefix) {
+			if !field.present && partial {
+				continue
+			}
+			if message, ok := rule.check(field); !ok {
+				errors = append(errors, FieldError{field.pointer, message})
+			}
+		}
+	}
+	return errors
+}
+
+// checkSchema validates a decoded request body. Partial bodies only contain
+// the fields to change, so missing required fields are not reported.
+func checkSchema(doc interface{}, schema Schema, partial bool) []FieldError {
+	if !schema.List {
+		if _, ok := doc.(map[string]interface{}); !ok {
+			return []FieldError{{"", "must be an object"}}
+		}
+		return checkRules(doc, schema.Rules, "", partial)
+	}
+	items, ok := doc.([]interface{})
+	if !ok {
+		return []FieldError{{"", "must be a list"}}
+	}
+	if schema.MaxItems > 0 && len(items) > schema.MaxItems {
+		return []FieldError{{"", "at most " + strconv.Itoa(schema.MaxItems) + " entries are allowed"}}
+	}
+	errors := []FieldError{}
+	for idx, item := range items {
+		prefix := "/" + strconv.Itoa(idx)
+		if _, ok := item.(map[string]interface{}); !ok {
+			errors = append(errors, FieldError{prefix, "must be an object"})
+			continue
+		}
+		errors = append(errors, checkRules(item, schema.Rules, prefix, partial)...)
+	}
+	return errors
+}
+
+// -------------------------------------------------------------------------------
+// Middleware
+// -------------------------------------------------------------------------------
+
+// limitBodySize rejects request bodies larger than MAX_BODY_SIZE. Imports
+// may be up to MAX_IMPORT_SIZE, since packages include their media. Media
+// uploads are limited by their own handler, whatever the content type.
+func limitBodySize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "/words/:id/media" {
+			c.Next()
+			return
+		}
+		limit := int64(MAX_BODY_SIZE)
+		if c.FullPath() == "/words/import" {
+			limit = MAX_IMPORT_SIZE
+		}
+		if c.Request.ContentLength > limit {
+			respondProblem(c, http.StatusRequestEntityTooLarge, ErrPayloadTooLarge, "request body too large")
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// validateBody checks the JSON body against the schema before the handler
+// runs. The body is restored afterwards so the handler can bind it.
+func validateBody(schema Schema, partial bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondBindError(c, err, "failed to read body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		var doc interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			respondBindError(c, err, "body is not valid JSON")
+			return
+		}
+		if errors := checkSchema(doc, schema, partial); len(errors) > 0 {
+			respondValidationProblem(c, errors)
+			return
+		}
+		c.Next()
+	}
+}
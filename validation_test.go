@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func decodeDocument(raw string) interface{} {
+	var doc interface{}
+	json.Unmarshal([]byte(raw), &doc)
+	return doc
+}
+
+func TestCheckSchema(t *testing.T) {
+	cases := []struct {
+		body    string
+		schema  Schema
+		partial bool
+		fields  []string
+	}{
+		{`{"Vocabulary": "Hund", "Translation": "dog"}`, wordSchema, false, []string{}},
+		{`{"Vocabulary": "", "Confidence": 101}`, wordSchema, false, []string{"/Vocabulary", "/Translation", "/Confidence"}},
+		{`{"Notes": "only the notes"}`, wordSchema, true, []string{}},
+		{`{"Vocabulary": null}`, wordSchema, false, []string{"/Vocabulary", "/Translation"}},
+		{`{"Vocabulary": "Hund", "Translation": "dog", "Repeat": 1.5}`, wordSchema, false, []string{"/Repeat"}},
+		{`{"Vocabulary": "Hund", "Translation": "dog", "Examples": [{"Sentence": 5}]}`, wordSchema, false, []string{"/Examples/0/Sentence"}},
+		{`{"Vocabulary": "Hund", "Translation": "dog", "Translations": {"es": "` + strings.Repeat("a", MAX_ANSWER_LENGTH+1) + `"}}`, wordSchema, false, []string{"/Translations/es"}},
+		{`[{"ID": 0, "Confidence": 50}, {"ID": -1, "Confidence": 500}]`, confidenceSchema, false, []string{"/1/ID", "/1/Confidence"}},
+		{`{"ID": 0}`, confidenceSchema, false, []string{""}},
+		{`[1]`, confidenceSchema, false, []string{"/0"}},
+	}
+	for _, test := range cases {
+		errors := checkSchema(decodeDocument(test.body), test.schema, test.partial)
+		fields := []string{}
+		for _, err := range errors {
+			fields = append(fields, err.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+			log.Printf("Body %s: expected errors for %v got %v", test.body, test.fields, errors)
+			t.Fail()
+		}
+	}
+
+	list := "[" + strings.TrimSuffix(strings.Repeat(`{"ID": 0},`, MAX_BATCH_SIZE+1), ",") + "]"
+	if errors := checkSchema(decodeDocument(list), confidenceSchema, false); len(errors) != 1 {
+		log.Printf("Too many items accepted: %v", errors)
+		t.Fail()
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(limitBodySize())
+	router.POST("/words", validateBody(wordSchema, false), func(c *gin.Context) {
+		var word Word
+		if err := c.ShouldBindJSON(&word); err != nil {
+			respondBindError(c, err, "word is in incorrect format")
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, word)
+	})
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"Vocabulary": "Hund", "Translation": "dog"}`, http.StatusCreated},
+		{`{"Vocabulary": "Hund", "Translation": "dog", "Confidence": -5}`, http.StatusUnprocessableEntity},
+		{`{"Vocabulary": "Hund"`, http.StatusBadRequest},
+		{`{"Vocabulary": "` + strings.Repeat("a", MAX_BODY_SIZE) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/words", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != test.status {
+			log.Printf("Expected %d got %d: %s", test.status, w.Code, w.Body.String())
+			t.Fail()
+		}
+	}
+
+	// Multipart bodies are limited as well, with or without a length
+	for _, chunked := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/words", bytes.NewBufferString(strings.Repeat("a", 5*MAX_BODY_SIZE)))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		if chunked {
+			req.ContentLength = -1
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			log.Printf("Oversized multipart body: expected 413 got %d", w.Code)
+			t.Fail()
+		}
+	}
+}
+
+func TestUpdateConfidenceOutOfRange(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+
+	vocabulary = []Word{{ID: 0, UUID: newUUID(), Vocabulary: "der Hund", Translation: "dog"}}
+	reviewHistory = []ReviewEvent{}
+	// Must not panic for indices that do not exist
+	updateConfidence([]WordConfidence{{ID: 5, Confidence: 50}, {ID: -1}, {ID: 0, Confidence: 30}}, "")
+	if vocabulary[0].Confidence != 30 {
+		log.Printf("Valid entry not applied: %+v", vocabulary[0])
+		t.FailNow()
+	}
+}
+
+func FuzzDecodeWord(f *testing.F) {
+	f.Add([]byte(`{"Vocabulary": "der Hund", "Translation": "dog", "Tags": ["animal"]}`))
+	f.Add([]byte(`{"Examples": [{"Sentence": null}], "Translations": {"": ""}}`))
+	f.Add([]byte(`{"Confidence": 1e400}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		checkSchema(decodeDocument(string(raw)), wordSchema, false)
+		checkSchema(decodeDocument(string(raw)), wordSchema, true)
+		var word Word
+		if json.Unmarshal(raw, &word) != nil {
+			return
+		}
+		normalizeWord(&word)
+		validateWord(word)
+		mergePatchWord(word, raw)
+	})
+}
+
+func FuzzDecodeConfidence(f *testing.F) {
+	f.Add([]byte(`[{"ID": 0, "Confidence": 50, "Repeat": 2}]`))
+	f.Add([]byte(`[{"ID": 99999999999}]`))
+	f.Add([]byte(`[null, {}]`))
+	dir, err := os.Getwd()
+	if err != nil {
+		f.FailNow()
+	}
+	os.Chdir(f.TempDir())
+	defer os.Chdir(dir)
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		checkSchema(decodeDocument(string(raw)), confidenceSchema, false)
+		var list []WordConfidence
+		if json.Unmarshal(raw, &list) != nil {
+			return
+		}
+		vocabulary = []Word{{ID: 0, UUID: "fuzz", Vocabulary: "der Hund", Translation: "dog"}}
+		reviewHistory = []ReviewEvent{}
+		if filterConfidence(list, -1) {
+			updateConfidence(list, "")
+		}
+	})
+}
+
+func FuzzJSONPatch(f *testing.F) {
+	f.Add([]byte(`[{"op": "add", "path": "/Tags/-", "value": "x"}]`))
+	f.Add([]byte(`[{"op": "move", "from": "/Examples", "path": "/Examples/0"}]`))
+	f.Add([]byte(`[{"op": "replace", "path": "", "value": null}]`))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		var operations []PatchOperation
+		if json.Unmarshal(raw, &operations) != nil {
+			return
+		}
+		word := Word{Vocabulary: "der Hund", Tags: []string{"a"}, Examples: []Example{{Sentence: "Der Hund bellt."}}}
+		jsonPatch(word, operations)
+	})
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/golang-jwt/jwt"
 )
 
@@ -22,16 +26,54 @@ type Wordv1 struct {
 
 type Word struct {
 	ID          int
+	UUID        string
+	Revision    int
+	Sequence    int // position of the last change, see sync.go
 	Vocabulary  string
 	Translation string
 	Confidence  int
 	Repeat      int
+	Schedule    Schedule
+	Created     time.Time
+	Deck        int
+	Tags        []string
+	// ISO 639 language codes, the deck languages are used if empty
+	SourceLanguage string
+	TargetLanguage string
+	Translations   map[string]string // language -> additional translation
+	// Hashes of the attached media files
+	Audio string
+	Image string
+	// Optional grammatical details
+	PartOfSpeech string
+	Gender       string
+	Article      string
+	Plural       string
+	Examples     []Example
+	Notes        string
+	Synonyms     []string
+	Antonyms     []string
+	// UUIDs of the words merged into this one, their history belongs to it
+	MergedUUIDs []string
+	// Last write of every changed field, used to resolve concurrent edits
+	Versions map[string]FieldVersion
 }
 
+// WordConfidence addresses the word by UUID, since the index changes when
+// words are removed. The ID is only used by older clients without UUID.
 type WordConfidence struct {
 	ID         int
+	UUID       string
 	Confidence int
 	Repeat     int
+	// When the answer was given, for updates sent after being offline
+	Time time.Time
+}
+
+type WordReview struct {
+	Grade        Grade
+	ResponseTime int
+	Direction    Direction
 }
 
 var IPWhitelist = map[string]bool{
@@ -45,22 +87,24 @@ var IPWhitelist = map[string]bool{
 
 var vocabulary = []Word{}
 
+// Older clients modify words via POST and expect the whole vocabulary after
+// every write. Set from the configuration on start.
+var legacyResponses = false
+
 // -------------------------------------------------------------------------------
 // Auxiliary Functions
 // -------------------------------------------------------------------------------
 
+// writeData replaces the vocabulary file. The data is written to a temporary
+// file first, so an error never leaves a partially written vocabulary.
 func writeData(data []byte) error {
 	file := "vocabulary.json"
-	f, err := os.Create(file)
-	if err != nil {
-		log.Printf("Failed to create file \"%s\"", file)
+	temp := file + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		log.Printf("Failed to write file \"%s\"", temp)
 		return err
 	}
-	// Don't forget to close the file
-	defer f.Close()
-	f.Write(data)
-
-	return nil
+	return os.Rename(temp, file)
 }
 
 func saveVocabulary(vocab *[]Wordv1) {
@@ -78,6 +122,8 @@ func saveVocabulary(vocab *[]Wordv1) {
 func saveVocabularyV2(vocab *[]Word) {
 	log.Print("Storing v2 of the vocabulary")
 	fixIndexingV2(vocab)
+	stampRevisions(*vocab)
+	saveSyncState()
 	rawData, err := json.MarshalIndent(*vocab, "", "\t")
 	if err != nil {
 		log.Print("Failed to convert data to JSON!")
@@ -149,6 +195,10 @@ func readDataV2() []Word {
 		}
 		vocabulary = convertWordv1toWordv2(oldVocab)
 	}
+	assignWordUUIDs(&vocabulary)
+	for idx := range vocabulary {
+		normalizeWord(&vocabulary[idx])
+	}
 	if len(vocabulary) > 10 {
 		log.Printf("Loaded vocabulary:\n%+v", vocabulary[:10])
 	} else {
@@ -158,6 +208,28 @@ func readDataV2() []Word {
 	return vocabulary
 }
 
+// normalizeWord brings optional fields into their canonical form so that
+// words read from older files look like newly created ones.
+func normalizeWord(word *Word) {
+	word.Tags = normalizeTags(word.Tags)
+	normalizeWordDetails(word)
+	word.SourceLanguage = normalizeLanguage(word.SourceLanguage)
+	word.TargetLanguage = normalizeLanguage(word.TargetLanguage)
+	word.Translations = normalizeTranslations(word.Translations)
+	if word.MergedUUIDs == nil {
+		word.MergedUUIDs = []string{}
+	}
+	if word.Versions == nil {
+		word.Versions = map[string]FieldVersion{}
+	}
+}
+
+func equalWords(a Word, b Word) bool {
+	normalizeWord(&a)
+	normalizeWord(&b)
+	return reflect.DeepEqual(a, b)
+}
+
 func convertWordv1toWordv2(words []Wordv1) []Word {
 	convertedList := make([]Word, len(words))
 	for idx, v := range words {
@@ -168,6 +240,7 @@ func convertWordv1toWordv2(words []Wordv1) []Word {
 			Confidence:  0,
 			Repeat:      0,
 		}
+		normalizeWord(&converted)
 		convertedList[idx] = converted
 	}
 	return convertedList
@@ -176,7 +249,7 @@ func convertWordv1toWordv2(words []Wordv1) []Word {
 func swapExistingVocabulary() {
 	log.Print("Swapping the existing vocabulary file")
 	vocab := "vocabulary.json"
-	_, err := os.Open(vocab)
+	_, err := os.Stat(vocab)
 	if err != nil {
 		log.Print("Vocabulary file does not exist")
 		return
@@ -193,7 +266,7 @@ func swapExistingVocabulary() {
 	counter := 1
 	filename := "vocabulary_" + strconv.Itoa(counter) + ".json"
 	for {
-		_, err = os.Open(filename)
+		_, err = os.Stat(filename)
 		if err != nil {
 			break
 		}
@@ -208,19 +281,76 @@ func swapExistingVocabulary() {
 	os.Create(vocab)
 }
 
-func updateConfidence(confidenceList []WordConfidence) {
+// confidenceTarget returns the index of the word of the update, or -1 if it
+// does not exist.
+func confidenceTarget(word WordConfidence) int {
+	if word.UUID != "" {
+		return indexOfUUID(vocabulary, word.UUID)
+	}
+	if word.ID >= len(vocabulary) || word.ID < 0 {
+		return -1
+	}
+	return word.ID
+}
+
+// filterConfidence checks that all words of the list belong to the given deck.
+// A negative deck ID allows words of all decks.
+func filterConfidence(confidenceList []WordConfidence, deck int) bool {
+	for _, word := range confidenceList {
+		idx := confidenceTarget(word)
+		if idx < 0 {
+			return false
+		}
+		if deck >= 0 && vocabulary[idx].Deck != deck {
+			return false
+		}
+	}
+	return true
+}
+
+// updateConfidence records the updates in the history. Updates of several
+// devices are merged by the time they were made: the latest one sets the
+// confidence, no matter in which order they arrive. Updates sent again are
+// only recorded once.
+func updateConfidence(confidenceList []WordConfidence, user string) {
 	log.Print("Updating confidence")
+	now := time.Now()
+	events := make([]ReviewEvent, 0, len(confidenceList))
+	updated := []int{}
 	for _, word := range confidenceList {
-		wordToUpdate := vocabulary[word.ID]
-		// Only store "positive" updates or negative answers; don't reset status
-		if word.Confidence >= wordToUpdate.Confidence-10 {
-			wordToUpdate.Confidence = word.Confidence
+		idx := confidenceTarget(word)
+		if idx < 0 {
+			log.Printf("Skipping confidence of unknown word %d %s", word.ID, word.UUID)
+			continue
+		}
+		at := word.Time
+		if at.IsZero() || at.After(now) {
+			at = now
 		}
-		if word.Repeat > wordToUpdate.Repeat {
-			wordToUpdate.Repeat = word.Repeat
+		// The number of repetitions only grows
+		if word.Repeat > vocabulary[idx].Repeat {
+			vocabulary[idx].Repeat = word.Repeat
 		}
-		vocabulary[word.ID] = wordToUpdate
+		updated = append(updated, idx)
+		if confidenceRecorded(vocabulary[idx].UUID, at, word.Confidence) {
+			continue
+		}
+		events = append(events, ReviewEvent{
+			WordUUID:   vocabulary[idx].UUID,
+			User:       user,
+			Time:       at,
+			Confidence: word.Confidence,
+		})
 	}
+	recordReviews(events...)
+	for _, idx := range updated {
+		vocabulary[idx].Confidence = latestConfidence(wordHistory(vocabulary[idx]), vocabulary[idx].Confidence)
+	}
+}
+
+func reviewWord(id int, review WordReview, user string, now time.Time) Word {
+	applyReview(&vocabulary[id], review, user, now)
+	return vocabulary[id]
 }
 
 // -------------------------------------------------------------------------------
@@ -228,32 +358,175 @@ func updateConfidence(confidenceList []WordConfidence) {
 // -------------------------------------------------------------------------------
 
 func getData(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, vocabulary)
+	filter, message := parseWordFilter(c)
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, message)
+		return
+	}
+	page, message := parseWordPage(c, filter)
+	if message != "" {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidParameter, message)
+		return
+	}
+	matching := filterWords(vocabulary, filter)
+	sortWords(vocabulary, matching, page.Sort, page.Locale)
+	selected, next := paginate(vocabulary, matching, page)
+	c.Header("X-Total-Count", strconv.Itoa(len(matching)))
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+		c.Header("Link", nextPageLink(c, next))
+	}
+
+	if checkIfNoneMatch(c, selectionETag(vocabulary, selected, c.Request.URL.RawQuery)) {
+		return
+	}
+	// The words are encoded one by one instead of copying the selection
+	respondList(c, http.StatusOK, len(selected), func(idx int) interface{} {
+		if filter.To != "" {
+			return translateWord(vocabulary[selected[idx]], filter.To)
+		}
+		return vocabulary[selected[idx]]
+	})
 }
 
 func postData(c *gin.Context) {
 	var newVocab Word
-	if err := c.BindJSON(&newVocab); err != nil {
-		log.Printf("Word is in incorrect format: %v", c.Request.Body)
+	if err := c.ShouldBindJSON(&newVocab); err != nil {
+		log.Printf("Word is in incorrect format: %s", err)
+		respondBindError(c, err, "word is in incorrect format")
+		return
+	}
+
+	normalizeWord(&newVocab)
+	if errors := validateWord(newVocab); len(errors) > 0 {
+		respondValidationProblem(c, errors)
 		return
 	}
 
+	if c.Query("allowDuplicate") != "true" {
+		if idx, found := findDuplicate(vocabulary, newVocab); found {
+			log.Printf("Word %q already exists at index %d", newVocab.Vocabulary, idx)
+			existing := vocabulary[idx]
+			c.Header("Location", wordLocation(existing))
+			problem := newProblem(http.StatusConflict, ErrWordExists, "word already exists")
+			problem.Existing = &existing
+			writeProblem(c, problem)
+			return
+		}
+	}
+
 	// Fixing the ID in the received Word
 	newVocab.ID = len(vocabulary)
+	newVocab.UUID = newUUID()
+	newVocab.Revision = 0
+	newVocab.Sequence = 0
+	newVocab.Versions = map[string]FieldVersion{}
+	newVocab.Created = time.Now()
 	vocabulary = append(vocabulary, newVocab)
+	searchIndex.add(newVocab)
 	saveVocabularyV2(&vocabulary)
-	c.IndentedJSON(http.StatusCreated, vocabulary)
+	if legacyResponses {
+		respond(c, http.StatusCreated, vocabulary)
+		return
+	}
+	respondWord(c, http.StatusCreated, len(vocabulary)-1)
 }
 
 func saveConfidence(c *gin.Context) {
 	var confidenceList []WordConfidence
-	if err := c.BindJSON(&confidenceList); err != nil {
-		log.Printf("ConfidenceList is in incorrect format: %v\n%s", c.Request.Body, err)
+	if err := c.ShouldBindJSON(&confidenceList); err != nil {
+		log.Printf("ConfidenceList is in incorrect format: %s", err)
+		respondBindError(c, err, "confidence list is in incorrect format")
 		return
 	}
-	updateConfidence(confidenceList)
+	deck, ok := deckFilter(c)
+	if !ok {
+		respondProblem(c, http.StatusBadRequest, ErrDeckNotFound, "given deck does not exist")
+		return
+	}
+	if !filterConfidence(confidenceList, deck) {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "given words do not exist in deck")
+		return
+	}
+	updateConfidence(confidenceList, userFromContext(c))
 	saveVocabularyV2(&vocabulary)
-	c.IndentedJSON(http.StatusAccepted, vocabulary)
+	if legacyResponses {
+		respond(c, http.StatusAccepted, vocabulary)
+		return
+	}
+	updated := make([]Word, 0, len(confidenceList))
+	for _, word := range confidenceList {
+		updated = append(updated, vocabulary[confidenceTarget(word)])
+	}
+	respond(c, http.StatusOK, updated)
+}
+
+func saveReview(c *gin.Context) {
+	id := c.Param("id")
+	compare, _ := strconv.Atoi(id)
+	var review WordReview
+	if err := c.ShouldBindJSON(&review); err != nil {
+		log.Printf("Review is in incorrect format: %s", err)
+		respondBindError(c, err, "invalid review")
+		return
+	}
+	if !review.Grade.valid() {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "grade out of range")
+		return
+	}
+	if review.Direction == "" {
+		review.Direction = DirectionForward
+	}
+	if !review.Direction.valid() {
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "unknown direction")
+		return
+	}
+	if compare >= len(vocabulary) || compare < 0 {
+		respondProblem(c, http.StatusBadRequest, ErrWordNotFound, "given index does not exist")
+		return
+	}
+
+	word := reviewWord(compare, review, userFromContext(c), time.Now())
+	saveVocabularyV2(&vocabulary)
+	respond(c, http.StatusOK, word)
+}
+
+func wordLocation(word Word) string {
+	return "/words/" + strconv.Itoa(word.ID)
+}
+
+// lookupWord returns the index of the word addressed in the URL
+func lookupWord(c *gin.Context) (int, bool) {
+	idx, err := strconv.Atoi(c.Param("id"))
+	if err != nil || idx >= len(vocabulary) || idx < 0 {
+		respondProblem(c, http.StatusNotFound, ErrWordNotFound, "word not found")
+		return -1, false
+	}
+	return idx, true
+}
+
+// respondWord answers a write with the affected word only
+func respondWord(c *gin.Context, status int, idx int) {
+	c.Header("Location", wordLocation(vocabulary[idx]))
+	c.Header("ETag", wordETag(vocabulary[idx]))
+	respond(c, status, vocabulary[idx])
+}
+
+// replaceWord stores the modified word at the given index. The learning
+// state is managed by the server and cannot be changed by clients.
+func replaceWord(c *gin.Context, idx int, modified Word) bool {
+	restoreLearningState(&modified, vocabulary[idx])
+	normalizeWord(&modified)
+	if errors := validateWord(modified); len(errors) > 0 {
+		respondValidationProblem(c, errors)
+		return false
+	}
+	vocabulary[idx] = modified
+	searchIndex.add(modified)
+
+	log.Printf("Updated %d to %+v", idx, modified)
+	saveVocabularyV2(&vocabulary)
+	return true
 }
 
 func getDataItem(c *gin.Context) {
@@ -262,72 +535,145 @@ func getDataItem(c *gin.Context) {
 
 	for _, word := range vocabulary {
 		if word.ID == compare {
-			c.IndentedJSON(http.StatusOK, word)
+			if checkIfNoneMatch(c, wordETag(word)) {
+				return
+			}
+			respond(c, http.StatusOK, word)
 			return
 		}
 	}
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "word not found"})
+	respondProblem(c, http.StatusNotFound, ErrWordNotFound, "word not found")
 }
 
+// modifyDataItem is the legacy update, which expects the ID in the body and
+// only changes the fields contained in it
 func modifyDataItem(c *gin.Context) {
 	id := c.Param("id")
 	compare, _ := strconv.Atoi(id)
 	var updatedWord Word
-	// dataBody := new(bytes.Buffer)
-	// _, err := io.Copy(dataBody, c.Request.Body)
-	// if err != nil {
-	// 	log.Printf("Failed to read full body?")
-	// }
-	// log.Printf("Got body: %s", dataBody.String())
-	err := c.ShouldBindJSON(&updatedWord)
+	err := c.ShouldBindBodyWith(&updatedWord, binding.JSON)
 	if err != nil {
 		log.Printf("Failed to bind to Word: %s", err)
+		respondBindError(c, err, "word is in incorrect format")
 		return
 	}
 	if compare != updatedWord.ID {
 		log.Print("incorrect word id and url id")
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": ""})
+		respondProblem(c, http.StatusBadRequest, ErrInvalidRequest, "word id does not match the url")
 		return
 	}
 	if compare >= len(vocabulary) || compare < 0 {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "given index does not exist"})
+		respondProblem(c, http.StatusBadRequest, ErrWordNotFound, "given index does not exist")
+		return
+	}
+	base, ok := checkBaseRevision(c, vocabulary[compare])
+	if !ok {
 		return
 	}
+	// Changes made since the revision the client has seen are kept. Without
+	// clocks there is no safe order, so fields changed by both are rejected.
+	if base != vocabulary[compare].Revision {
+		var fields map[string]json.RawMessage
+		if err := c.ShouldBindBodyWith(&fields, binding.JSON); err == nil {
+			if _, _, conflicts := mergeFields(vocabulary[compare], base, fields, nil, PolicyManual); len(conflicts) > 0 {
+				c.Header("ETag", wordETag(vocabulary[compare]))
+				problem := newProblem(http.StatusConflict, ErrEditConflict, "word was modified in the meantime")
+				problem.Errors = conflicts
+				writeProblem(c, problem)
+				return
+			}
+		}
+	}
 
-	vocabulary[compare].Vocabulary = updatedWord.Vocabulary
-	vocabulary[compare].Translation = updatedWord.Translation
+	// Only the fields contained in the body are changed, so older clients
+	// that do not know about the optional fields do not remove them
+	modified := cloneWord(vocabulary[compare])
+	if err := c.ShouldBindBodyWith(&modified, binding.JSON); err != nil {
+		log.Printf("Failed to bind to Word: %s", err)
+		respondBindError(c, err, "word is in incorrect format")
+		return
+	}
+	if !replaceWord(c, compare, modified) {
+		return
+	}
+	c.Header("ETag", wordETag(vocabulary[compare]))
+	respond(c, http.StatusCreated, vocabulary)
+}
 
-	log.Printf("Updated %d to %+v", compare, updatedWord)
-	saveVocabularyV2(&vocabulary)
-	c.IndentedJSON(http.StatusCreated, vocabulary)
+// replaceDataItem replaces all fields of the word. Fields missing in the body
+// are cleared, except for the learning state which is kept.
+func replaceDataItem(c *gin.Context) {
+	idx, ok := lookupWord(c)
+	if !ok || !checkIfMatch(c, vocabulary[idx]) {
+		return
+	}
+	var replacement Word
+	if err := c.ShouldBindJSON(&replacement); err != nil {
+		log.Printf("Failed to bind to Word: %s", err)
+		respondBindError(c, err, "word is in incorrect format")
+		return
+	}
+	if replaceWord(c, idx, replacement) {
+		respondWord(c, http.StatusOK, idx)
+	}
 }
 
-func removeDataItem(c *gin.Context) {
-	id := c.Param("id")
-	compare, _ := strconv.Atoi(id)
-	var removeWord Word
-	err := c.ShouldBindJSON(&removeWord)
+// patchDataItem applies either a JSON Merge Patch or a JSON Patch, depending
+// on the content type. Plain JSON is treated as merge patch.
+func patchDataItem(c *gin.Context) {
+	idx, ok := lookupWord(c)
+	if !ok || !checkIfMatch(c, vocabulary[idx]) {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Print("given body does not contain valid word")
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": ""})
+		respondBindError(c, err, "failed to read patch")
 		return
 	}
-	if compare != removeWord.ID {
-		log.Print("incorrect word id and url id")
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": ""})
+
+	var patched Word
+	switch c.ContentType() {
+	case JSON_PATCH_TYPE:
+		var operations []PatchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			log.Printf("Patch is in incorrect format: %s", err)
+			respondProblem(c, http.StatusBadRequest, ErrMalformedBody, "patch is in incorrect format")
+			return
+		}
+		patched, err = jsonPatch(vocabulary[idx], operations)
+	case MERGE_PATCH_TYPE, binding.MIMEJSON:
+		if !json.Valid(body) {
+			respondProblem(c, http.StatusBadRequest, ErrMalformedBody, "patch is in incorrect format")
+			return
+		}
+		patched, err = mergePatchWord(vocabulary[idx], body)
+	default:
+		c.Header("Accept-Patch", MERGE_PATCH_TYPE+", "+JSON_PATCH_TYPE)
+		respondProblem(c, http.StatusUnsupportedMediaType, ErrUnsupportedMediaType, "unsupported patch format")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to apply patch: %s", err)
+		respondProblem(c, http.StatusUnprocessableEntity, ErrPatchFailed, err.Error())
 		return
 	}
+	if replaceWord(c, idx, patched) {
+		respondWord(c, http.StatusOK, idx)
+	}
+}
+
+func removeDataItem(c *gin.Context) {
+	id := c.Param("id")
+	compare, _ := strconv.Atoi(id)
 	if compare >= len(vocabulary) || compare < 0 {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "given index does not exist"})
+		respondProblem(c, http.StatusBadRequest, ErrWordNotFound, "given index does not exist")
 		return
 	}
 
 	// log.Printf("Full Vocab: %+v", vocabulary)
 
 	wordToRemove := vocabulary[compare]
-	if wordToRemove != removeWord {
-		log.Print("remove vocab word does not match")
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": ""})
+	if !checkIfMatch(c, wordToRemove) {
 		return
 	}
 
@@ -335,11 +681,17 @@ func removeDataItem(c *gin.Context) {
 	swapExistingVocabulary()
 
 	vocabulary = append(vocabulary[:compare], vocabulary[compare+1:]...)
+	cleanupMedia(wordToRemove.Audio, wordToRemove.Image)
+	searchIndex.remove(wordToRemove.UUID)
 
-	log.Printf("Removed item at index %d", compare)
+	log.Printf("Removed item %s at index %d", wordToRemove.UUID, compare)
 	// log.Printf("Full Vocab: %+v", vocabulary)
 	saveVocabularyV2(&vocabulary)
-	c.IndentedJSON(http.StatusOK, vocabulary)
+	if legacyResponses {
+		respond(c, http.StatusOK, vocabulary)
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 // -------------------------------------------------------------------------------
@@ -359,7 +711,7 @@ func authenticationMiddleware() gin.HandlerFunc {
 		tokenString := c.GetHeader("Authorization")
 		// log.Printf("Header: %s", tokenString)
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			respondProblem(c, http.StatusUnauthorized, ErrUnauthorized, "authorization header is missing")
 			return
 		}
 		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
@@ -374,7 +726,7 @@ func authenticationMiddleware() gin.HandlerFunc {
 		// log.Printf("Parsing got: %s, %s", token.Raw, err)
 		if err != nil {
 			log.Printf("Invalid token: %s", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			respondProblem(c, http.StatusUnauthorized, ErrInvalidToken, "invalid token")
 			return
 		}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
@@ -382,7 +734,7 @@ func authenticationMiddleware() gin.HandlerFunc {
 			c.Next()
 		} else {
 			log.Printf("Invalid claims: %s", claims.Valid().Error())
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			respondProblem(c, http.StatusUnauthorized, ErrInvalidToken, "invalid token")
 		}
 	}
 }
@@ -402,19 +754,68 @@ func startingServer(cfg Configuration) error {
 		println("New token: ", token)
 		return nil
 	}
+	syncState = readSyncState()
 	if cfg.Overwrite {
 		swapExistingVocabulary()
+		expireSyncTokens()
 	}
 	vocabulary = readDataV2()
-	router := gin.Default()
-
+	rebuildSearchIndex()
+	userSettings = readSettings()
+	reviewHistory = readHistory()
+	decks, lastDeckID = readDecks()
+	legacyResponses = cfg.Legacy
+	if cfg.Max_Batch_Size > 0 {
+		maxBatchSize = cfg.Max_Batch_Size
+	}
+	printFontFile = cfg.Font_File
+	minCompressSize = cfg.Compress_Size
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(routeNotFound)
+	router.NoMethod(methodNotAllowed)
+
+	router.Use(requestIDMiddleware(), gin.Logger(), gin.CustomRecovery(recoverWithProblem), compressResponse(), limitBodySize(), decodeBody())
 	router.Use(authenticationMiddleware())
 	router.Use(IPWhiteList(IPWhitelist))
 	router.GET("/words", getData)
+	router.GET("/words/search", searchData)
+	router.GET("/words/duplicates", getDuplicates)
+	router.POST("/words/merge", mergeDataItems)
+	router.POST("/words/batch", postBatch)
+	router.GET("/sync", getChanges)
+	router.POST("/sync", postChanges)
+	router.GET("/words/export", exportData)
+	router.POST("/words/import", importData)
 	router.GET("/words/:id", getDataItem)
-	router.POST("words", postData)
-	router.POST("/words/:id", modifyDataItem)
-	router.POST("/confidence", saveConfidence)
+	router.POST("words", validateBody(wordSchema, false), postData)
+	router.PUT("/words/:id", validateBody(wordSchema, false), replaceDataItem)
+	router.PATCH("/words/:id", patchDataItem)
+	if cfg.Legacy {
+		router.POST("/words/:id", validateBody(wordSchema, true), modifyDataItem)
+	}
+	router.POST("/words/tags", bulkTagWords)
+	router.GET("/tags", getTags)
+	router.POST("/words/:id/review", saveReview)
+	router.GET("/words/:id/history", getWordHistory)
+	router.POST("/words/:id/media", uploadMedia)
+	router.GET("/media/:hash", getMedia)
+	router.POST("/history/rebuild", rebuildFromHistory)
+	router.GET("/stats", getStatistics)
+	router.GET("/decks", getDecks)
+	router.POST("/decks", postDeck)
+	router.GET("/decks/:id", getDeck)
+	router.POST("/decks/:id", modifyDeck)
+	router.DELETE("/decks/:id", removeDeck)
+	router.GET("/decks/:id/words", getDeckWords)
+	router.POST("/decks/:id/words", moveDeckWords)
+	router.GET("/decks/:id/print.pdf", printDeck)
+	router.POST("/quiz", createQuiz)
+	router.GET("/quiz/:session", getQuiz)
+	router.POST("/quiz/:session/answer", answerQuiz)
+	router.POST("/confidence", validateBody(confidenceSchema, false), saveConfidence)
+	router.GET("/settings", getSettings)
+	router.POST("/settings", modifySettings)
 	router.DELETE("/words/:id", removeDataItem)
 
 	address := cfg.IP_Address + ":" + cfg.Listen_Port
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Example is a sentence using a word together with its translation.
+type Example struct {
+	Sentence    string
+	Translation string
+}
+
+var partsOfSpeech = map[string]bool{
+	"noun":         true,
+	"verb":         true,
+	"adjective":    true,
+	"adverb":       true,
+	"pronoun":      true,
+	"preposition":  true,
+	"conjunction":  true,
+	"interjection": true,
+	"article":      true,
+	"numeral":      true,
+	"phrase":       true,
+	"other":        true,
+}
+
+var grammaticalGenders = map[string]bool{
+	"masculine": true,
+	"feminine":  true,
+	"neuter":    true,
+	"common":    true,
+}
+
+func normalizeWordList(list []string) []string {
+	normalized := []string{}
+	for _, entry := range list {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized
+}
+
+// normalizeWordDetails fills the optional grammatical fields with their
+// canonical values. Words stored before these fields existed only contain
+// empty values and are left unchanged otherwise.
+func normalizeWordDetails(word *Word) {
+	word.PartOfSpeech = strings.ToLower(strings.TrimSpace(word.PartOfSpeech))
+	word.Gender = strings.ToLower(strings.TrimSpace(word.Gender))
+	word.Article = strings.TrimSpace(word.Article)
+	word.Plural = strings.TrimSpace(word.Plural)
+	word.Notes = strings.TrimSpace(word.Notes)
+	word.Synonyms = normalizeWordList(word.Synonyms)
+	word.Antonyms = normalizeWordList(word.Antonyms)
+	if word.Examples == nil {
+		word.Examples = []Example{}
+	}
+}
+
+// cloneWord returns a copy of the word which does not share any slices with
+// the original word.
+func cloneWord(word Word) Word {
+	word.Tags = append([]string{}, word.Tags...)
+	word.Examples = append([]Example{}, word.Examples...)
+	word.Synonyms = append([]string{}, word.Synonyms...)
+	word.Antonyms = append([]string{}, word.Antonyms...)
+	word.MergedUUIDs = append([]string{}, word.MergedUUIDs...)
+	translations := map[string]string{}
+	for language, text := range word.Translations {
+		translations[language] = text
+	}
+	word.Translations = translations
+	versions := map[string]FieldVersion{}
+	for field, version := range word.Versions {
+		versions[field] = version
+	}
+	word.Versions = versions
+	return word
+}
+
+// restoreLearningState resets all fields of a modified word which clients
+// cannot change directly to the values of the original word.
+func restoreLearningState(modified *Word, original Word) {
+	modified.ID = original.ID
+	modified.UUID = original.UUID
+	modified.Revision = original.Revision
+	modified.Sequence = original.Sequence
+	modified.Confidence = original.Confidence
+	modified.Repeat = original.Repeat
+	modified.Schedule = original.Schedule
+	modified.Created = original.Created
+	modified.Deck = original.Deck
+	modified.Audio = original.Audio
+	modified.Image = original.Image
+	modified.MergedUUIDs = original.MergedUUIDs
+	modified.Versions = original.Versions
+}
+
+// validateWord checks a word received from a client and returns all invalid
+// fields, or nothing if the word is valid.
+func validateWord(word Word) []FieldError {
+	errors := checkRules(toDocument(word), wordRules, "", false)
+	if word.PartOfSpeech != "" && !partsOfSpeech[word.PartOfSpeech] {
+		errors = append(errors, FieldError{"/PartOfSpeech", "unknown part of speech"})
+	}
+	if word.Gender != "" && !grammaticalGenders[word.Gender] {
+		errors = append(errors, FieldError{"/Gender", "unknown grammatical gender"})
+	}
+	if word.PartOfSpeech != "" && word.PartOfSpeech != "noun" {
+		if word.Gender != "" {
+			errors = append(errors, FieldError{"/Gender", "gender is only allowed for nouns"})
+		}
+		if word.Plural != "" {
+			errors = append(errors, FieldError{"/Plural", "plural is only allowed for nouns"})
+		}
+	}
+	for idx, example := range word.Examples {
+		if strings.TrimSpace(example.Sentence) == "" {
+			errors = append(errors, FieldError{"/Examples/" + strconv.Itoa(idx) + "/Sentence", "example sentence is missing"})
+		}
+	}
+	errors = append(errors, validateLanguages(word)...)
+	if !deckExists(word.Deck) {
+		errors = append(errors, FieldError{"/Deck", "given deck does not exist"})
+	}
+	return errors
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestValidateWord(t *testing.T) {
+	cases := []struct {
+		word  Word
+		valid bool
+	}{
+		{Word{Vocabulary: "der Hund, -e (m)", Translation: "dog"}, true},
+		{Word{Vocabulary: "Hund", Translation: "dog", PartOfSpeech: "Noun ", Gender: "Masculine", Article: "der", Plural: "Hunde"}, true},
+		{Word{Vocabulary: "laufen", PartOfSpeech: "verb", Plural: "laufen"}, false},
+		{Word{Vocabulary: "Hund", PartOfSpeech: "thing"}, false},
+		{Word{Vocabulary: "Hund", Gender: "male"}, false},
+		{Word{Vocabulary: "Hund", Examples: []Example{{Sentence: " ", Translation: "The dog"}}}, false},
+		{Word{Vocabulary: "Hund", Translation: "dog", Examples: []Example{{Sentence: "Der Hund bellt.", Translation: "The dog barks."}}}, true},
+		{Word{Vocabulary: " ", Translation: "dog"}, false},
+		{Word{Vocabulary: "Hund", Translation: "dog", Confidence: -1}, false},
+		{Word{Vocabulary: "Hund", Translation: "dog", Repeat: MAX_REPEAT + 1}, false},
+		{Word{Vocabulary: strings.Repeat("a", MAX_TEXT_LENGTH+1), Translation: "dog"}, false},
+	}
+	for _, test := range cases {
+		normalizeWord(&test.word)
+		if valid := len(validateWord(test.word)) == 0; valid != test.valid {
+			log.Printf("Word %+v: expected valid=%t got %v", test.word, test.valid, validateWord(test.word))
+			t.Fail()
+		}
+	}
+}
+
+func TestMigrateOldWord(t *testing.T) {
+	// Words stored before the rich word model keep all their data
+	raw := []byte(`[{"ID":0,"Vocabulary":"der Hund, -e (m)","Translation":"dog","Confidence":40,"Repeat":3}]`)
+	var words []Word
+	if err := json.Unmarshal(raw, &words); err != nil {
+		t.FailNow()
+	}
+	normalizeWord(&words[0])
+	word := words[0]
+	if word.Vocabulary != "der Hund, -e (m)" || word.Confidence != 40 || word.Repeat != 3 {
+		log.Printf("Data lost during migration: %+v", word)
+		t.FailNow()
+	}
+	if word.Examples == nil || word.Synonyms == nil || word.Tags == nil {
+		log.Printf("Optional lists not initialized: %+v", word)
+		t.FailNow()
+	}
+}